@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+// maxAnalyticsRange caps how many days one analytics request covers.
+const maxAnalyticsRange = 90
+
+type AnalyticsResponse struct {
+	From  string                `json:"from"`
+	To    string                `json:"to"`
+	Posts []store.PostAnalytics `json:"posts"`
+}
+
+// GetAnalytics godoc
+//
+//	@Summary		Fetches post analytics
+//	@Description	Daily views, comments, reposts and quotes of the current user's posts. Defaults to the last 30 days.
+//	@Tags			users
+//	@Produce		json
+//	@Param			from	query		string	false	"First day, YYYY-MM-DD"
+//	@Param			to		query		string	false	"Last day, YYYY-MM-DD"
+//	@Success		200		{object}	AnalyticsResponse
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/analytics [get]
+func (app *application) getAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -29)
+
+	qs := r.URL.Query()
+	if v := qs.Get("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		to = t
+		from = to.AddDate(0, 0, -29)
+	}
+	if v := qs.Get("from"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		app.badRequestResponse(w, r, errors.New("from must not be after to"))
+		return
+	}
+	if to.Sub(from) >= maxAnalyticsRange*24*time.Hour {
+		app.badRequestResponse(w, r, errors.New("analytics cover at most 90 days at a time"))
+		return
+	}
+
+	stats, err := app.store.Analytics.GetForAuthor(r.Context(), getAuthUserID(r), from, to)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	resp := AnalyticsResponse{
+		From:  from.Format(time.DateOnly),
+		To:    to.Format(time.DateOnly),
+		Posts: stats,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, resp); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,26 +17,82 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/temideewan/go-social/docs" // required to generate the swagger docs
+	"github.com/temideewan/go-social/internal/analytics"
+	"github.com/temideewan/go-social/internal/blob"
+	"github.com/temideewan/go-social/internal/filter"
+	"github.com/temideewan/go-social/internal/imaging"
 	"github.com/temideewan/go-social/internal/store"
+	"github.com/temideewan/go-social/internal/timeline"
+	"github.com/temideewan/go-social/internal/unfurl"
 )
 
 type application struct {
-	config config
-	store  store.Storage
-	logger *zap.SugaredLogger
+	config   config
+	store    store.Storage
+	logger   *zap.SugaredLogger
+	blob     blob.BlobStore
+	images   *imaging.Processor
+	unfurler *unfurl.Unfurler
+	filters  *filter.Chain
+	views    *analytics.Recorder
+	fanout   *timeline.Fanout
+	// stopWorkers cancels the context the background workers run under
+	stopWorkers context.CancelFunc
 }
 
 type config struct {
-	addr   string
-	db     dbConfig
-	env    string
-	apiUrl string
-	mail   mailConfig
+	addr     string
+	db       dbConfig
+	env      string
+	apiUrl   string
+	mail     mailConfig
+	media    mediaConfig
+	posts    postsConfig
+	users    usersConfig
+	views    analytics.Config
+	pages    pagesConfig
+	timeline timeline.Config
+}
+
+type pagesConfig struct {
+	// maxLimit is the largest page a client can ask for
+	maxLimit int
+	// cursorSecret signs pagination cursors
+	cursorSecret string
+}
+
+type usersConfig struct {
+	// usernameCooldown is the time a user has to wait between username changes
+	usernameCooldown time.Duration
+}
+
+type postsConfig struct {
+	maxPinned     int
+	linkPreviews  unfurl.Config
+	filterRefresh time.Duration
 }
 
 type mailConfig struct {
 	exp time.Duration
 }
+
+type mediaConfig struct {
+	maxUploadSize int64
+	backend       string
+	localDir      string
+	s3            s3Config
+	processing    imaging.Config
+}
+
+type s3Config struct {
+	endpoint  string
+	accessKey string
+	secretKey string
+	bucket    string
+	region    string
+	useSSL    bool
+	publicURL string
+}
 type dbConfig struct {
 	addr         string
 	maxOpenConns int
@@ -53,6 +114,7 @@ func (app *application) mount() http.Handler {
 		docsUrl := fmt.Sprintf("%s/v1/swagger/doc.json", app.config.apiUrl)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
 		r.Route("/posts", func(r chi.Router) {
+			r.Use(app.authMiddleware)
 			r.Post("/", app.createPostHandler)
 
 			r.Get("/", app.getAllPostHandler)
@@ -62,23 +124,84 @@ func (app *application) mount() http.Handler {
 				r.Get("/", app.getPostHandler)
 				r.Delete("/", app.deletePostHandler)
 				r.Put("/", app.updatePostHandler)
+				r.Put("/repost", app.repostHandler)
+				r.Delete("/repost", app.unrepostHandler)
+				r.Put("/bookmark", app.bookmarkPostHandler)
+				r.Delete("/bookmark", app.unbookmarkPostHandler)
+				r.Put("/pin", app.pinPostHandler)
+				r.Delete("/pin", app.unpinPostHandler)
+				r.Post("/poll/votes", app.votePollHandler)
+				r.Post("/comments", app.createCommentHandler)
+			})
+		})
+
+		r.Route("/media", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(app.authMiddleware)
+				r.Post("/", app.uploadMediaHandler)
+				r.Get("/{mediaID}", app.getMediaHandler)
 			})
+			if local, ok := app.blob.(*blob.LocalStore); ok {
+				r.Handle("/files/*", http.StripPrefix("/v1/media/files/", http.FileServer(http.Dir(local.Dir()))))
+			}
 		})
 
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
-			r.Route("/{userID}", func(r chi.Router) {
-				r.Use(app.userContextMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
-
-			})
 			r.Group(func(r chi.Router) {
+				r.Use(app.authMiddleware)
+				r.Get("/search", app.searchUsersHandler)
+				r.Get("/by-username/{username}", app.getUserByUsernameHandler)
+				r.Route("/me", func(r chi.Router) {
+					r.Patch("/", app.updateProfileHandler)
+					r.Put("/username", app.changeUsernameHandler)
+					r.Get("/mentions", app.getUserMentionsHandler)
+					r.Get("/analytics", app.getAnalyticsHandler)
+					r.Get("/suggestions", app.getSuggestionsHandler)
+					r.Get("/blocks", app.getBlockedUsersHandler)
+					r.Get("/mutes", app.getMutedUsersHandler)
+					r.Route("/follow-requests", func(r chi.Router) {
+						r.Get("/", app.getFollowRequestsHandler)
+						r.Post("/{requesterID}/accept", app.acceptFollowRequestHandler)
+						r.Post("/{requesterID}/reject", app.rejectFollowRequestHandler)
+					})
+					r.Route("/bookmarks", func(r chi.Router) {
+						r.Get("/", app.getBookmarksHandler)
+						r.Get("/collections", app.getBookmarkCollectionsHandler)
+						r.Post("/collections", app.createBookmarkCollectionHandler)
+						r.Delete("/collections/{collectionID}", app.deleteBookmarkCollectionHandler)
+					})
+				})
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Use(app.userContextMiddleware)
+					r.Get("/", app.getUserHandler)
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+					r.Get("/followers", app.getFollowersHandler)
+					r.Get("/following", app.getFollowingHandler)
+					r.Get("/posts", app.getUserPostsHandler)
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Put("/unmute", app.unmuteUserHandler)
+
+				})
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 
 		})
+
+		r.Route("/reports", func(r chi.Router) {
+			r.Use(app.authMiddleware)
+			r.Post("/", app.createReportHandler)
+		})
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(app.authMiddleware)
+			r.Use(app.moderatorMiddleware)
+			r.Get("/reports", app.getReportsHandler)
+			r.Post("/reports/{reportID}/resolve", app.resolveReportHandler)
+		})
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 		})
@@ -98,6 +221,35 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute,
 	}
+
+	shutdown := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		app.logger.Infow("signal caught", "signal", s.String())
+
+		if err := srv.Shutdown(ctx); err != nil {
+			shutdown <- err
+			return
+		}
+		// no more views can come in, stop the workers and write out the
+		// views the recorder is still holding
+		app.stopWorkers()
+		shutdown <- app.views.Wait(ctx)
+	}()
+
 	app.logger.Infow("Server has started at", "addr", app.config.addr, "env", app.config.env)
-	return srv.ListenAndServe()
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if err := <-shutdown; err != nil {
+		return err
+	}
+	app.logger.Infow("Server has stopped", "addr", app.config.addr, "env", app.config.env)
+	return nil
 }
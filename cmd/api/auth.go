@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -10,7 +12,7 @@ import (
 )
 
 type RegisterUserPayload struct {
-	Username string `json:"username" validate:"required,max=100"`
+	Username string `json:"username" validate:"required,max=100,username"`
 	Email    string `json:"email" validate:"required,email,max=100"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
@@ -88,3 +90,58 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 }
+
+// getAuthUserID returns the ID of the user making the request.
+// TODO: read it from the auth token once authentication is in place
+func getAuthUserID(r *http.Request) int64 {
+	return 1
+}
+
+type authUserKey string
+
+const authUserCtx authUserKey = "authUser"
+
+var errSuspended = errors.New("this account has been suspended")
+
+// authMiddleware loads the user making the request and turns away
+// suspended accounts.
+func (app *application) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, err := app.store.Users.GetById(ctx, getAuthUserID(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if user.SuspendedAt != nil {
+			app.forbiddenResponse(w, r, errSuspended)
+			return
+		}
+
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// moderatorMiddleware only lets moderators through. It expects
+// authMiddleware to have run first.
+func (app *application) moderatorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUser(r)
+		if user == nil || user.Role != store.RoleModerator {
+			app.forbiddenResponse(w, r, errors.New("moderator access required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getAuthUser(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
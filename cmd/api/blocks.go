@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+var errSelfRelation = errors.New("you can't block or mute yourself")
+
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID. Follows between the two users are removed and neither sees the other's content.
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{object}	string	"User blocked"
+//	@Failure		400	{object}	error
+//	@Failure		409	{object}	error	"Already blocked"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationshipResponse(w, r, app.store.Blocks.Block)
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user by ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{object}	string	"User unblocked"
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error	"User not blocked"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationshipResponse(w, r, app.store.Blocks.Unblock)
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Mutes a user by ID. Their posts, comments and mentions no longer show up for the current user.
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{object}	string	"User muted"
+//	@Failure		400	{object}	error
+//	@Failure		409	{object}	error	"Already muted"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationshipResponse(w, r, app.store.Blocks.Mute)
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmutes a user
+//	@Description	Unmutes a user by ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{object}	string	"User unmuted"
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error	"User not muted"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/unmute [put]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationshipResponse(w, r, app.store.Blocks.Unmute)
+}
+
+func (app *application) relationshipResponse(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, userID, otherID int64) error) {
+	user := getUserFromContext(r)
+	userID := getAuthUserID(r)
+	if user.ID == userID {
+		app.badRequestResponse(w, r, errSelfRelation)
+		return
+	}
+
+	if err := change(r.Context(), userID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlockedUsers godoc
+//
+//	@Summary		Lists blocked users
+//	@Description	Lists the users the current user blocked, most recent first, with cursor pagination
+//	@Tags			users
+//	@Produce		json
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.RelatedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedUsersResponse(w, r, app.store.Blocks.GetBlocked)
+}
+
+// GetMutedUsers godoc
+//
+//	@Summary		Lists muted users
+//	@Description	Lists the users the current user muted, most recent first, with cursor pagination
+//	@Tags			users
+//	@Produce		json
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.RelatedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mutes [get]
+func (app *application) getMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.relatedUsersResponse(w, r, app.store.Blocks.GetMuted)
+}
+
+func (app *application) relatedUsersResponse(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.RelatedUser, store.Cursors, error)) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, cursors, err := list(r.Context(), getAuthUserID(r), fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, users, cursors); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+type BookmarkPayload struct {
+	CollectionID *int64 `json:"collection_id" validate:"omitempty,gt=0"`
+}
+
+type CreateBookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// BookmarkPost godoc
+//
+//	@Summary		Bookmarks a post
+//	@Description	Privately saves a post for later, optionally in a collection. Bookmarking again moves the bookmark.
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int				true	"Post ID"
+//	@Param			payload	body		BookmarkPayload	false	"Bookmark collection"
+//	@Success		204		{object}	string			"Post bookmarked"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/bookmark [put]
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	// the body is optional
+	var payload BookmarkPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err := app.store.Bookmarks.Bookmark(r.Context(), getAuthUserID(r), post.ID, payload.CollectionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCollection):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnbookmarkPost godoc
+//
+//	@Summary		Removes a bookmark
+//	@Description	Removes a post from the current user's bookmarks
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{object}	string	"Bookmark removed"
+//	@Failure		404		{object}	error	"Bookmark not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/bookmark [delete]
+func (app *application) unbookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	if err := app.store.Bookmarks.Unbookmark(r.Context(), getAuthUserID(r), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBookmarks godoc
+//
+//	@Summary		Fetches the current user's bookmarks
+//	@Description	Lists bookmarked posts, newest bookmark first, with cursor pagination
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			collection	query		int		false	"Collection ID"
+//	@Param			cursor		query		string	false	"Cursor from a previous page"
+//	@Param			limit		query		string	false	"Limit"
+//	@Param			sort		query		string	false	"Sort"
+//	@Param			since		query		string	false	"Bookmarked at or after"
+//	@Param			until		query		string	false	"Bookmarked at or before"
+//	@Param			tags		query		string	false	"Tags the post has"
+//	@Param			search		query		string	false	"Search in the post title and content"
+//	@Success		200			{object}	[]store.Bookmark
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks [get]
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var collectionID *int64
+	if param := r.URL.Query().Get("collection"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		collectionID = &id
+	}
+
+	bookmarks, cursors, err := app.store.Bookmarks.GetForUser(r.Context(), getAuthUserID(r), collectionID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, bookmarks, cursors); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// CreateBookmarkCollection godoc
+//
+//	@Summary		Creates a bookmark collection
+//	@Description	Creates a named collection to organise bookmarks
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateBookmarkCollectionPayload	true	"Collection"
+//	@Success		201		{object}	store.BookmarkCollection
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error	"Collection already exists"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections [post]
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &store.BookmarkCollection{
+		UserID: getAuthUserID(r),
+		Name:   payload.Name,
+	}
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetBookmarkCollections godoc
+//
+//	@Summary		Fetches the current user's bookmark collections
+//	@Description	Lists bookmark collections by name
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Success		200	{object}	[]store.BookmarkCollection
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections [get]
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), getAuthUserID(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteBookmarkCollection godoc
+//
+//	@Summary		Deletes a bookmark collection
+//	@Description	Deletes a collection, its bookmarks are kept without a collection
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			collectionID	path		int		true	"Collection ID"
+//	@Success		204				{object}	string	"Collection deleted"
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error	"Collection not found"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections/{collectionID} [delete]
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), getAuthUserID(r), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
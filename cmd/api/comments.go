@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/temideewan/go-social/internal/filter"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CreateComment godoc
+//
+//	@Summary		Comments on a post
+//	@Description	Adds a comment to a post. Comments flagged by the content filters are held for moderation.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := &store.Comment{
+		PostId:  post.ID,
+		UserId:  getAuthUserID(r),
+		Content: payload.Content,
+	}
+	ctx := r.Context()
+
+	result, err := app.filters.Check(ctx, filter.Content{
+		UserID: comment.UserId,
+		Kind:   filter.KindComment,
+		Body:   comment.Content,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	switch result.Decision {
+	case filter.Reject:
+		app.badRequestResponse(w, r, errors.New(result.Reason))
+		return
+	case filter.Hold:
+		comment.HeldForReview = true
+		comment.HoldReason = result.Reason
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
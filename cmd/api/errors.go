@@ -20,3 +20,19 @@ func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request,
 	app.logger.Errorw("conflict", "error", err.Error(), "path", r.URL.Path, "method", r.Method)
 	writeJSONError(w, http.StatusConflict, err.Error())
 }
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("payload too large", "error", err.Error(), "path", r.URL.Path, "method", r.Method)
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("unsupported media type", "error", err.Error(), "path", r.URL.Path, "method", r.Method)
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+func (app *application) unauthorizedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("unauthorized", "error", err.Error(), "path", r.URL.Path, "method", r.Method)
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("forbidden", "error", err.Error(), "path", r.URL.Path, "method", r.Method)
+	writeJSONError(w, http.StatusForbidden, err.Error())
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/temideewan/go-social/internal/store"
@@ -9,7 +10,7 @@ import (
 // CreatePost godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user's own posts and the posts and reposts of the accounts they follow. New posts reach followers' feeds shortly after they are created.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
@@ -19,16 +20,20 @@ import (
 //	@Param			sort	query		string	false	"Sort"
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
+//	@Param			cursor	query		string	false	"next_cursor or prev_cursor from a previous page, takes precedence over offset"
+//	@Param			offset	query		string	false	"Offset"
 //	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
 	// pagination, filters, sort
 	fq := store.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
 	}
 	fq, err := fq.Parse(r)
 	if err != nil {
@@ -42,12 +47,113 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(1), fq)
+	viewerID := getAuthUserID(r)
+	feed, cursors, err := app.store.Timelines.GetFeed(ctx, viewerID, fq)
 	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	for _, p := range feed {
+		app.views.Record(viewerID, p.ID, p.UserID)
+	}
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feed, cursors); err != nil {
 		app.internalServerError(w, r, err)
+	}
+}
+
+// GetUserPosts godoc
+//
+//	@Summary		Fetches a user's timeline
+//	@Description	Lists a user's posts and reposts. The replies tab adds the posts the user commented on, the media tab only has posts with attachments.
+//	@Description	On the posts tab the user's pinned posts lead the first page.
+//	@Tags			feed
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			tab		query		string	false	"posts (default), replies or media"
+//	@Param			since	query		string	false	"Since"
+//	@Param			until	query		string	false	"Until"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Param			cursor	query		string	false	"next_cursor or prev_cursor from a previous page, takes precedence over offset"
+//	@Param			offset	query		string	false	"Offset"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"Private account"
+//	@Failure		404		{object}	error	"User not found or blocked"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/posts [get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tab := store.TimelinePosts
+	if param := r.URL.Query().Get("tab"); param != "" {
+		tab = param
+	}
+	if err := Validate.Var(tab, "oneof=posts replies media"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	viewerID := getAuthUserID(r)
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewerID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+	allowed, err := app.canSeeAccount(ctx, user, viewerID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r, errPrivateAccount)
+		return
+	}
+
+	posts, cursors, err := app.store.Posts.GetUserTimeline(ctx, user.ID, viewerID, tab, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	for _, p := range posts {
+		app.views.Record(viewerID, p.ID, p.UserID)
+	}
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, cursors); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
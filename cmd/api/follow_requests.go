@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+// GetFollowRequests godoc
+//
+//	@Summary		Lists pending follow requests
+//	@Description	Lists the requests to follow the current user, newest first, with cursor pagination
+//	@Tags			users
+//	@Produce		json
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.FollowRequest
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	requests, cursors, err := app.store.Followers.GetFollowRequests(r.Context(), getAuthUserID(r), fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, requests, cursors); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// AcceptFollowRequest godoc
+//
+//	@Summary		Accepts a follow request
+//	@Description	Accepts a pending request, the requester starts following the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			requesterId	path		int		true	"Requester user ID"
+//	@Success		204			{object}	string	"Request accepted"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"Request not found"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{requesterId}/accept [post]
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Followers.AcceptFollowRequest)
+}
+
+// RejectFollowRequest godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Rejects a pending request to follow the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			requesterId	path		int		true	"Requester user ID"
+//	@Success		204			{object}	string	"Request rejected"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"Request not found"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{requesterId}/reject [post]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Followers.RejectFollowRequest)
+}
+
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(ctx context.Context, userID, requesterID int64) error) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := answer(r.Context(), getAuthUserID(r), requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,14 +3,61 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/temideewan/go-social/internal/markdown"
+	"github.com/temideewan/go-social/internal/store"
 )
 
 var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+	Validate.RegisterValidation("maxtext", validateMaxText)
+	Validate.RegisterValidation("username", validateUsername)
+}
+
+// reservedUsernames can't be registered, they'd be confused with the site
+// itself or with its routes.
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"help":          true,
+	"me":            true,
+	"moderator":     true,
+	"root":          true,
+	"search":        true,
+	"security":      true,
+	"settings":      true,
+	"support":       true,
+	"system":        true,
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// validateUsername accepts letters, digits and underscores, and rejects the
+// reserved names whatever their case.
+func validateUsername(fl validator.FieldLevel) bool {
+	username := fl.Field().String()
+	return usernamePattern.MatchString(username) && !reservedUsernames[strings.ToLower(username)]
+}
+
+// validateMaxText limits the visible length of a markdown field, so markup
+// such as link targets doesn't count against the limit.
+func validateMaxText(fl validator.FieldLevel) bool {
+	max, err := strconv.Atoi(fl.Param())
+	if err != nil {
+		return false
+	}
+	length, err := markdown.VisibleLength(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	return length <= max
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -40,3 +87,13 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// paginatedJSONResponse is jsonResponse for cursor paginated lists. The
+// cursors are left out at either end of the list.
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, status int, data any, cursors store.Cursors) error {
+	type envelope struct {
+		Data any `json:"data"`
+		store.Cursors
+	}
+	return writeJSON(w, status, &envelope{Data: data, Cursors: cursors})
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"time"
 
+	"github.com/temideewan/go-social/internal/analytics"
+	"github.com/temideewan/go-social/internal/blob"
 	"github.com/temideewan/go-social/internal/db"
 	"github.com/temideewan/go-social/internal/env"
+	"github.com/temideewan/go-social/internal/filter"
+	"github.com/temideewan/go-social/internal/imaging"
 	"github.com/temideewan/go-social/internal/store"
+	"github.com/temideewan/go-social/internal/timeline"
+	"github.com/temideewan/go-social/internal/unfurl"
 	"go.uber.org/zap"
 
 	_ "github.com/temideewan/go-social/docs"
@@ -45,6 +53,57 @@ func main() {
 		mail: mailConfig{
 			exp: time.Hour * 24 * 3, // 3 days
 		},
+		media: mediaConfig{
+			maxUploadSize: int64(env.GetInt("MEDIA_MAX_UPLOAD_SIZE", 10<<20)), // 10mb
+			backend:       env.GetString("MEDIA_BACKEND", "local"),
+			localDir:      env.GetString("MEDIA_LOCAL_DIR", "./uploads"),
+			s3: s3Config{
+				endpoint:  env.GetString("S3_ENDPOINT", "localhost:9000"),
+				accessKey: env.GetString("S3_ACCESS_KEY", "minioadmin"),
+				secretKey: env.GetString("S3_SECRET_KEY", "minioadmin"),
+				bucket:    env.GetString("S3_BUCKET", "media"),
+				region:    env.GetString("S3_REGION", "us-east-1"),
+				useSSL:    env.GetBool("S3_USE_SSL", false),
+				publicURL: env.GetString("S3_PUBLIC_URL", ""),
+			},
+			processing: imaging.Config{
+				ThumbnailWidths: env.GetIntSlice("MEDIA_THUMBNAIL_WIDTHS", []int{160, 480, 1080}),
+				Workers:         env.GetInt("MEDIA_WORKERS", 2),
+				QueueSize:       env.GetInt("MEDIA_QUEUE_SIZE", 100),
+				Timeout:         time.Minute,
+			},
+		},
+		posts: postsConfig{
+			maxPinned: env.GetInt("MAX_PINNED_POSTS", 3),
+			linkPreviews: unfurl.Config{
+				Workers:     env.GetInt("LINK_PREVIEW_WORKERS", 2),
+				QueueSize:   env.GetInt("LINK_PREVIEW_QUEUE_SIZE", 100),
+				Timeout:     5 * time.Second,
+				MaxBodySize: int64(env.GetInt("LINK_PREVIEW_MAX_BODY_SIZE", 1<<20)), // 1mb
+				CacheTTL:    time.Duration(env.GetInt("LINK_PREVIEW_CACHE_TTL_HOURS", 24)) * time.Hour,
+				UserAgent:   "GopherSocialBot/" + version,
+			},
+			filterRefresh: time.Duration(env.GetInt("CONTENT_FILTER_REFRESH_SECONDS", 30)) * time.Second,
+		},
+		users: usersConfig{
+			usernameCooldown: time.Duration(env.GetInt("USERNAME_CHANGE_COOLDOWN_DAYS", 30)) * 24 * time.Hour,
+		},
+		views: analytics.Config{
+			FlushInterval: time.Duration(env.GetInt("VIEWS_FLUSH_SECONDS", 10)) * time.Second,
+			DedupWindow:   time.Duration(env.GetInt("VIEWS_DEDUP_MINUTES", 30)) * time.Minute,
+		},
+		pages: pagesConfig{
+			maxLimit:     env.GetInt("PAGE_MAX_LIMIT", 20),
+			cursorSecret: env.GetString("CURSOR_SECRET", ""),
+		},
+		timeline: timeline.Config{
+			Workers:            env.GetInt("TIMELINE_WORKERS", 2),
+			QueueSize:          env.GetInt("TIMELINE_QUEUE_SIZE", 1000),
+			Timeout:            30 * time.Second,
+			CelebrityFollowers: env.GetInt("TIMELINE_CELEBRITY_FOLLOWERS", 10000),
+			SweepInterval:      time.Minute,
+			MaxEntries:         env.GetInt("TIMELINE_MAX_ENTRIES", 800),
+		},
 	}
 	// logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
@@ -64,14 +123,78 @@ func main() {
 	defer db.Close()
 	logger.Info("Database connection pool established")
 
+	// the handlers' default page size has to fit under the cap
+	if cfg.pages.maxLimit < 20 {
+		logger.Fatal("PAGE_MAX_LIMIT can't be lower than the default page size of 20")
+	}
+
+	// without a configured secret cursors still work, but only until a restart
+	cursorKey := []byte(cfg.pages.cursorSecret)
+	if len(cursorKey) == 0 {
+		cursorKey = make([]byte, 32)
+		if _, err := rand.Read(cursorKey); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Warn("CURSOR_SECRET is not set, pagination cursors won't survive a restart")
+	}
+	store.SetCursorKey(cursorKey)
+
 	store := store.NewStorage(db)
 
+	// blob storage
+	var blobStore blob.BlobStore
+	switch cfg.media.backend {
+	case "s3":
+		blobStore, err = blob.NewS3Store(context.Background(), blob.S3Config{
+			Endpoint:  cfg.media.s3.endpoint,
+			AccessKey: cfg.media.s3.accessKey,
+			SecretKey: cfg.media.s3.secretKey,
+			Bucket:    cfg.media.s3.bucket,
+			Region:    cfg.media.s3.region,
+			UseSSL:    cfg.media.s3.useSSL,
+			PublicURL: cfg.media.s3.publicURL,
+		})
+	default:
+		blobStore, err = blob.NewLocalStore(cfg.media.localDir, cfg.apiUrl+"/v1/media/files")
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("Blob storage initialised", "backend", cfg.media.backend)
+
+	// cancelled on shutdown, see run
+	workers, stopWorkers := context.WithCancel(context.Background())
+
+	images := imaging.NewProcessor(store, blobStore, logger, cfg.media.processing)
+	images.Start(workers)
+
+	unfurler := unfurl.NewUnfurler(store, logger, cfg.posts.linkPreviews)
+	unfurler.Start(workers)
+
+	filters := filter.NewChain(store, logger, cfg.posts.filterRefresh)
+
+	views := analytics.NewRecorder(store, logger, cfg.views)
+	views.Start(workers)
+
+	fanout := timeline.NewFanout(store, logger, cfg.timeline)
+	fanout.Start(workers)
+
 	app := &application{
-		config: cfg,
-		store:  store,
-		logger: logger,
+		config:   cfg,
+		store:    store,
+		logger:   logger,
+		blob:     blobStore,
+		images:   images,
+		unfurler: unfurler,
+		filters:  filters,
+		views:    views,
+		fanout:   fanout,
+
+		stopWorkers: stopWorkers,
 	}
 
 	mux := app.mount()
-	logger.Fatal(app.run(mux))
+	if err := app.run(mux); err != nil {
+		logger.Fatal(err)
+	}
 }
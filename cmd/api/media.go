@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/temideewan/go-social/internal/imaging"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+var allowedMediaTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"video/mp4",
+}
+
+// UploadMedia godoc
+//
+//	@Summary		Uploads a media file
+//	@Description	Uploads an image or video that can later be attached to a post.
+//	@Description	Images are stripped of their metadata on upload and resized in the background, poll the media record until its status is ready.
+//	@Description	The url is only set once the media is ready, and only ready media can be attached to posts.
+//	@Tags			media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Media file"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error	"File too large"
+//	@Failure		415		{object}	error	"Unsupported media type"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	maxSize := app.config.media.maxUploadSize
+	// leave some room for the multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1024*1024)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.payloadTooLargeResponse(w, r, fmt.Errorf("file exceeds the %d byte limit", maxSize))
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxSize {
+		app.payloadTooLargeResponse(w, r, fmt.Errorf("file exceeds the %d byte limit", maxSize))
+		return
+	}
+
+	// never trust the client supplied content type, sniff the bytes instead
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !mimetype.EqualsAny(mtype.String(), allowedMediaTypes...) {
+		app.unsupportedMediaTypeResponse(w, r, fmt.Errorf("unsupported media type %q", mtype.String()))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	media := &store.Media{
+		UserID:   getAuthUserID(r),
+		MimeType: mtype.String(),
+		Status:   store.MediaStatusReady,
+	}
+	// the original is never stored, its EXIF and GPS data would be served
+	// to anyone with the url
+	if imaging.IsProcessable(media.MimeType) {
+		data, err = imaging.Sanitize(data, media.MimeType)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		media.Status = store.MediaStatusPending
+	}
+	media.Size = int64(len(data))
+	media.StorageKey = fmt.Sprintf("%d/%s%s", media.UserID, uuid.New().String(), mtype.Extension())
+
+	ctx := r.Context()
+	if err := app.blob.Put(ctx, media.StorageKey, bytes.NewReader(data), media.Size, media.MimeType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if media.Status == store.MediaStatusReady {
+		media.URL = app.blob.URL(media.StorageKey)
+	}
+	if err := app.store.Media.Create(ctx, media); err != nil {
+		_ = app.blob.Delete(ctx, media.StorageKey)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if media.Status == store.MediaStatusPending {
+		// a full queue is not fatal, pending media is picked up again on restart
+		if err := app.images.Enqueue(media.ID); err != nil {
+			app.logger.Warnw("could not queue media for processing", "media_id", media.ID, "error", err.Error())
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, media); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetMedia godoc
+//
+//	@Summary		Fetches a media record
+//	@Description	Fetches a media record including its processing status and thumbnails. Only media the caller uploaded, or that is attached to a post they can see, is found.
+//	@Tags			media
+//	@Produce		json
+//	@Param			mediaID	path		int	true	"Media ID"
+//	@Success		200		{object}	store.Media
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Media not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID} [get]
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	media, err := app.store.Media.GetVisibleById(r.Context(), id, getAuthUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, media); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+// GetUserMentions godoc
+//
+//	@Summary		Fetches the mentions of the current user
+//	@Description	Lists the posts and comments where the current user was @mentioned
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			offset	query		string	false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.UserMention
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mentions [get]
+func (app *application) getUserMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	mentions, err := app.store.Mentions.GetForUser(r.Context(), getAuthUserID(r), fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, mentions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+type ResolveReportPayload struct {
+	Action string `json:"action" validate:"required,oneof=dismiss hide warn suspend"`
+	Note   string `json:"note" validate:"max=1000"`
+}
+
+// GetReports godoc
+//
+//	@Summary		Lists reports
+//	@Description	Lists reports for the moderation queue, oldest first
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status		query		string	false	"open (default) or resolved"
+//	@Param			target_type	query		string	false	"post, comment or user"
+//	@Param			reason		query		string	false	"Report reason"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.Report
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports [get]
+func (app *application) getReportsHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.ReportQuery{
+		Status: store.ReportStatusOpen,
+		Limit:  50,
+	}
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reports, err := app.store.Reports.GetAll(r.Context(), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, reports); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ResolveReport godoc
+//
+//	@Summary		Resolves a report
+//	@Description	Resolves an open report by dismissing it, hiding the content, warning or suspending the user
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportId	path		int						true	"Report ID"
+//	@Param			payload		body		ResolveReportPayload	true	"Moderation action"
+//	@Success		200			{object}	store.ModerationAction
+//	@Failure		400			{object}	error	"Action not allowed for this report"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Report not found"
+//	@Failure		409			{object}	error	"Report already resolved"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportId}/resolve [post]
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload ResolveReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	action, err := app.store.Reports.Resolve(r.Context(), reportID, getAuthUserID(r), payload.Action, payload.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrInvalidAction):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrReportResolved):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("report resolved", "report_id", reportID, "moderator_id", action.ModeratorID, "action", action.Action)
+	if err := app.jsonResponse(w, http.StatusOK, action); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+type PollPayload struct {
+	Options        []string  `json:"options" validate:"min=2,max=6,dive,required,max=100"`
+	MultipleChoice bool      `json:"multiple_choice"`
+	ClosesAt       time.Time `json:"closes_at" validate:"required"`
+}
+
+type PollVotePayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"required,min=1,max=6,dive,gt=0"`
+}
+
+// VotePoll godoc
+//
+//	@Summary		Votes in a poll
+//	@Description	Records the current user's vote in the poll attached to a post and returns the tallies
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int				true	"Post ID"
+//	@Param			payload	body		PollVotePayload	true	"Chosen options"
+//	@Success		201		{object}	store.Poll
+//	@Failure		400		{object}	error	"Poll is closed or the options are invalid"
+//	@Failure		404		{object}	error	"Post has no poll"
+//	@Failure		409		{object}	error	"Already voted"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/poll/votes [post]
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	var payload PollVotePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	poll, err := app.store.Polls.Vote(r.Context(), post.ID, getAuthUserID(r), payload.OptionIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrPollClosed), errors.Is(err, store.ErrInvalidVote):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrAlreadyVoted):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, poll); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
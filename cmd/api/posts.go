@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/temideewan/go-social/internal/filter"
 	"github.com/temideewan/go-social/internal/store"
+	"github.com/temideewan/go-social/internal/unfurl"
 )
 
 type PostKey string
@@ -16,13 +19,23 @@ type PostKey string
 const postCtx PostKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title       string              `json:"title" validate:"required,max=100"`
+	Content     string              `json:"content" validate:"required,max=10000,maxtext=1000"`
+	Tags        []string            `json:"tags" validate:"max=10,dive,max=100"`
+	Attachments []AttachmentPayload `json:"attachments" validate:"max=4,dive"`
+	QuoteOfID   *int64              `json:"quote_of_id" validate:"omitempty,gt=0"`
+	Visibility  string              `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
+	Poll        *PollPayload        `json:"poll" validate:"omitempty"`
+}
+
+type AttachmentPayload struct {
+	MediaID int64  `json:"media_id" validate:"required"`
+	AltText string `json:"alt_text" validate:"max=1000"`
 }
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string `json:"title" validate:"omitempty,max=100"`
+	Content    *string `json:"content" validate:"omitempty,max=10000,maxtext=1000"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
 }
 
 // CreatePost godoc
@@ -32,9 +45,10 @@ type UpdatePostPayload struct {
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Success		201	{object}	store.Post
-//	@Failure		400	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			payload	body		CreatePostPayload	true	"Post payload"
+//	@Success		201		{object}	store.Post
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,18 +65,72 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		// TODO change after auth
-		UserID: 1,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     getAuthUserID(r),
+		QuoteOfID:  payload.QuoteOfID,
+		Visibility: payload.Visibility,
+	}
+	for _, a := range payload.Attachments {
+		post.Attachments = append(post.Attachments, store.Attachment{
+			MediaID: a.MediaID,
+			AltText: a.AltText,
+		})
+	}
+	if payload.Poll != nil {
+		if !payload.Poll.ClosesAt.After(time.Now()) {
+			app.badRequestResponse(w, r, errors.New("poll closes_at must be in the future"))
+			return
+		}
+		post.Poll = &store.Poll{
+			MultipleChoice: payload.Poll.MultipleChoice,
+			ClosesAt:       payload.Poll.ClosesAt,
+		}
+		for _, text := range payload.Poll.Options {
+			post.Poll.Options = append(post.Poll.Options, store.PollOption{Text: text})
+		}
 	}
 	ctx := r.Context()
 
-	if err := app.store.Posts.Create(ctx, post); err != nil {
+	result, err := app.filters.Check(ctx, filter.Content{
+		UserID: post.UserID,
+		Kind:   filter.KindPost,
+		Title:  post.Title,
+		Body:   post.Content,
+	})
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	switch result.Decision {
+	case filter.Reject:
+		app.badRequestResponse(w, r, errors.New(result.Reason))
+		return
+	case filter.Hold:
+		post.HeldForReview = true
+		post.HoldReason = result.Reason
+	}
+
+	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidMedia), errors.Is(err, store.ErrMediaNotReady), errors.Is(err, store.ErrTooManyTags), errors.Is(err, store.ErrInvalidQuote):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if unfurl.HasURL(post.Content) {
+		if err := app.unfurler.Enqueue(post.ID); err != nil {
+			app.logger.Warnw("could not queue link preview", "post_id", post.ID, "error", err.Error())
+		}
+	}
+
+	if err := app.fanout.EnqueuePost(post.ID); err != nil {
+		app.logger.Warnw("could not queue timeline fan-out", "post_id", post.ID, "error", err.Error())
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -87,12 +155,13 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Router			/posts/{postId} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
-	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID)
+	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID, getAuthUserID(r))
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comments = comments
+	app.views.Record(getAuthUserID(r), post.ID, post.UserID)
 
 	if err = app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -115,17 +184,56 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetAllPosts godoc
+//
+//	@Summary		Lists posts
+//	@Description	Lists the posts visible to the current user, newest first by default
+//	@Tags			posts
+//	@Produce		json
+//	@Param			author	query		int		false	"Author user ID"
+//	@Param			since	query		string	false	"Since"
+//	@Param			until	query		string	false	"Until"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			offset	query		string	false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts [get]
 func (app *application) getAllPostHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	posts, err := app.store.Posts.GetAllPosts(ctx)
-
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
 	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrNotFound):
-			app.notFoundResponse(w, r, err)
-		default:
-			app.internalServerError(w, r, err)
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var authorID *int64
+	if author := r.URL.Query().Get("author"); author != "" {
+		id, err := strconv.ParseInt(author, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
 		}
+		authorID = &id
+	}
+
+	ctx := r.Context()
+	posts, err := app.store.Posts.GetAllPosts(ctx, getAuthUserID(r), authorID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 	if err = app.jsonResponse(w, http.StatusOK, posts); err != nil {
@@ -162,12 +270,16 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 
 	}
 
+	contentChanged := payload.Content != nil && *payload.Content != post.Content
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
 
 	ctx := r.Context()
 	err := app.store.Posts.UpdatePost(ctx, post)
@@ -177,16 +289,145 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 			return
+		case errors.Is(err, store.ErrTooManyTags):
+			app.badRequestResponse(w, r, err)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
 		}
 	}
+
+	// the preview is refreshed, or removed when the url is gone
+	if contentChanged && (post.LinkPreview != nil || unfurl.HasURL(post.Content)) {
+		if err := app.unfurler.Enqueue(post.ID); err != nil {
+			app.logger.Warnw("could not queue link preview", "post_id", post.ID, "error", err.Error())
+		}
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// Repost godoc
+//
+//	@Summary		Reposts a post
+//	@Description	Shares a post with the followers of the current user
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{object}	string	"Post reposted"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		409		{object}	error	"Post already reposted"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/repost [put]
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	userID := getAuthUserID(r)
+	if err := app.store.Reposts.Repost(r.Context(), userID, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.fanout.EnqueueRepost(userID, post.ID); err != nil {
+		app.logger.Warnw("could not queue timeline fan-out", "post_id", post.ID, "reposted_by", userID, "error", err.Error())
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unrepost godoc
+//
+//	@Summary		Removes a repost
+//	@Description	Removes the current user's repost of a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{object}	string	"Repost removed"
+//	@Failure		404		{object}	error	"Repost not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/repost [delete]
+func (app *application) unrepostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	if err := app.store.Reposts.Unrepost(r.Context(), getAuthUserID(r), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PinPost godoc
+//
+//	@Summary		Pins a post
+//	@Description	Pins one of the current user's public posts to the top of their profile
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{object}	string	"Post pinned"
+//	@Failure		400		{object}	error	"Post can't be pinned or the pin limit was reached"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		409		{object}	error	"Post already pinned"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/pin [put]
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	err := app.store.Pins.Pin(r.Context(), getAuthUserID(r), post.ID, app.config.posts.maxPinned)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrPinNotAllowed):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrTooManyPins):
+			app.badRequestResponse(w, r, fmt.Errorf("%w: at most %d posts can be pinned", err, app.config.posts.maxPinned))
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnpinPost godoc
+//
+//	@Summary		Unpins a post
+//	@Description	Removes a post from the current user's pinned posts
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{object}	string	"Post unpinned"
+//	@Failure		404		{object}	error	"Pin not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/pin [delete]
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	if err := app.store.Pins.Unpin(r.Context(), getAuthUserID(r), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		idParam := chi.URLParam(r, "postID")
@@ -197,7 +438,8 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		}
 		ctx := r.Context()
 
-		post, err := app.store.Posts.GetById(ctx, id)
+		// posts the user can't see are reported as not found
+		post, err := app.store.Posts.GetVisibleById(ctx, id, getAuthUserID(r))
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrNotFound):
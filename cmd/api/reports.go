@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+type CreateReportPayload struct {
+	TargetType string `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID   int64  `json:"target_id" validate:"required,gt=0"`
+	Reason     string `json:"reason" validate:"required,oneof=spam harassment hate violence nudity misinformation other"`
+	Details    string `json:"details" validate:"max=1000"`
+}
+
+// CreateReport godoc
+//
+//	@Summary		Reports content
+//	@Description	Reports a post, comment or user to the moderators
+//	@Tags			reports
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateReportPayload	true	"Report payload"
+//	@Success		201		{object}	store.Report
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Reported content not found"
+//	@Failure		409		{object}	error	"Already reported"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reports [post]
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reporterID := getAuthUserID(r)
+	report := &store.Report{
+		ReporterID: &reporterID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	}
+	if err := app.store.Reports.Create(r.Context(), report); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errors.New("you have already reported this"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+// SearchUsers godoc
+//
+//	@Summary		Searches users
+//	@Description	Finds users by username or display name. Prefix matches come first, then close matches.
+//	@Tags			users
+//	@Produce		json
+//	@Param			q		query		string	true	"Search term"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.User
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/search [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.UserSearchQuery{
+		Limit: 20,
+	}
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := app.store.Users.Search(r.Context(), getAuthUserID(r), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetSuggestions godoc
+//
+//	@Summary		Suggests users to follow
+//	@Description	Suggests users followed by the people the current user follows, ranked by the number of mutual connections
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit, at most 50"
+//	@Success		200		{object}	[]store.SuggestedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/suggestions [get]
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if param := r.URL.Query().Get("limit"); param != "" {
+		l, err := strconv.Atoi(param)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		limit = l
+	}
+	if err := Validate.Var(limit, "gte=1,lte=50"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	suggestions, err := app.store.Users.GetSuggestions(r.Context(), getAuthUserID(r), limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
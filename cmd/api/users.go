@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/temideewan/go-social/internal/store"
@@ -13,6 +16,11 @@ type userKey string
 
 const userCtx userKey = "users"
 
+type UserProfile struct {
+	*store.User
+	PinnedPosts []store.Post `json:"pinned_posts"`
+}
+
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
@@ -21,34 +29,280 @@ const userCtx userKey = "users"
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	UserProfile
 //	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
+//	@Failure		404	{object}	error	"User not found or blocked"
 //	@Failure		500	{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	viewerID := getAuthUserID(r)
+	ctx := r.Context()
+
+	// blocked users are out of sight for the blocker
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewerID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	pinned, err := app.store.Pins.GetPinned(ctx, user.ID, viewerID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user.Birthday != nil && viewerID != user.ID {
+		switch user.BirthdayVisibility {
+		case store.BirthdayFollowers:
+			following, err := app.store.Followers.IsFollowing(ctx, viewerID, user.ID)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !following {
+				user.Birthday = nil
+			}
+		case store.BirthdayPublic:
+		default:
+			user.Birthday = nil
+		}
+	}
+
+	profile := UserProfile{
+		User:        user,
+		PinnedPosts: pinned,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
-type FollowerUser struct {
-	UserID int64 `json:"user_id"`
+type RenamedUser struct {
+	Username string `json:"username"`
+}
+
+// GetUserByUsername godoc
+//
+//	@Summary		Fetches a user profile by username
+//	@Description	Fetch a user profile by username, ignoring case. A former username redirects to the user's current one.
+//	@Tags			users
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	UserProfile
+//	@Success		302			{object}	RenamedUser	"The user was renamed"
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/by-username/{username} [get]
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if err == nil {
+		ctx = context.WithValue(ctx, userCtx, user)
+		app.getUserHandler(w, r.WithContext(ctx))
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	current, err := app.store.Users.GetRenamedUsername(ctx, username)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// a former username may be taken back, so the redirect isn't permanent
+	w.Header().Set("Location", "/v1/users/by-username/"+url.PathEscape(current))
+	if err := app.jsonResponse(w, http.StatusFound, RenamedUser{Username: current}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type ChangeUsernamePayload struct {
+	Username string `json:"username" validate:"required,max=100,username"`
+}
+
+// ChangeUsername godoc
+//
+//	@Summary		Changes the current user's username
+//	@Description	Renames the current user. The old username redirects to the new one and stays reserved for the user. Usernames can be changed once per cooldown period.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeUsernamePayload	true	"New username"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error	"Invalid username or changed too recently"
+//	@Failure		409		{object}	error	"Username taken"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/username [put]
+func (app *application) changeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeUsernamePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, getAuthUserID(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ChangeUsername(ctx, user, payload.Username, app.config.users.usernameCooldown); err != nil {
+		switch {
+		case errors.Is(err, store.ErrUsernameCooldown):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrDuplicateUserName):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateProfilePayload struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=160"`
+	// AvatarMediaID is an uploaded image, 0 removes the avatar
+	AvatarMediaID      *int64  `json:"avatar_media_id" validate:"omitempty,gte=0"`
+	Location           *string `json:"location" validate:"omitempty,max=100"`
+	Website            *string `json:"website" validate:"omitempty,max=200"`
+	Birthday           *string `json:"birthday"`
+	BirthdayVisibility *string `json:"birthday_visibility" validate:"omitempty,oneof=public followers private"`
+	IsPrivate          *bool   `json:"is_private"`
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Updates the current user's profile
+//	@Description	Updates the profile fields that are present in the payload. An empty website or birthday, or an avatar_media_id of 0, clears the field. Making the account public accepts its pending follow requests.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile fields"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// empty strings clear these fields, so they are only checked when set
+	if payload.Website != nil {
+		if err := Validate.Var(*payload.Website, "omitempty,http_url"); err != nil {
+			app.badRequestResponse(w, r, errors.New("website must be an http or https url"))
+			return
+		}
+	}
+	if payload.Birthday != nil && *payload.Birthday != "" {
+		birthday, err := time.Parse(time.DateOnly, *payload.Birthday)
+		if err != nil || birthday.After(time.Now()) {
+			app.badRequestResponse(w, r, errors.New("birthday must be a past date formatted as YYYY-MM-DD"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, getAuthUserID(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.AvatarMediaID != nil {
+		user.AvatarMediaID = payload.AvatarMediaID
+		if *payload.AvatarMediaID == 0 {
+			user.AvatarMediaID = nil
+		}
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.Birthday != nil {
+		user.Birthday = payload.Birthday
+		if *payload.Birthday == "" {
+			user.Birthday = nil
+		}
+	}
+	if payload.BirthdayVisibility != nil {
+		user.BirthdayVisibility = *payload.BirthdayVisibility
+	}
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+
+	if err := app.store.Users.UpdateProfile(ctx, user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidMedia):
+			app.badRequestResponse(w, r, errors.New("avatar must be an image you uploaded"))
+		case errors.Is(err, store.ErrMediaNotReady):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 // FollowUser godoc
 //
 //	@Summary		Follow a user profile
-//	@Description	Follow a user profile by ID
+//	@Description	Follow a user profile by ID. Following a private account sends a follow request instead.
 //	@Tags			users
-//	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
+//	@Success		202	{object}	string	"Follow requested"
 //	@Success		204	{object}	string	"User followed"
 //	@Failure		400	{object}	error
+//	@Failure		403	{object}	error	"Blocked"
 //	@Failure		404	{object}	error	"User not found"
 //	@Failure		500	{object}	error
 //	@Security		ApiKeyAuth
@@ -56,15 +310,9 @@ type FollowerUser struct {
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
 	followedUser := getUserFromContext(r)
 
-	// TODO: revert to auth userID from ctx
-	var payload FollowerUser
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
 	ctx := r.Context()
-	if err := app.store.Followers.Follow(ctx, followedUser.ID, payload.UserID); err != nil {
+	requested, err := app.store.Followers.Follow(ctx, getAuthUserID(r), followedUser.ID)
+	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundResponse(w, r, err)
@@ -72,6 +320,9 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		case store.ErrConflict:
 			app.conflictResponse(w, r, err)
 			return
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r, err)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
@@ -79,10 +330,114 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+	status := http.StatusNoContent
+	if requested {
+		status = http.StatusAccepted
+	}
+	if err := app.jsonResponse(w, status, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// GetFollowers godoc
+//
+//	@Summary		Lists a user's followers
+//	@Description	Lists the users following a user, most recent follow first, with cursor pagination
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.FollowListEntry
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"Private account"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Followers.GetFollowers)
+}
+
+// GetFollowing godoc
+//
+//	@Summary		Lists the users a user follows
+//	@Description	Lists the users a user follows, most recent follow first, with cursor pagination
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Param			limit	query		string	false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.FollowListEntry
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"Private account"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Followers.GetFollowing)
+}
+
+var errPrivateAccount = errors.New("this account is private")
+
+// canSeeAccount reports whether viewerID may see the activity of user, which
+// only its followers can for a private account.
+func (app *application) canSeeAccount(ctx context.Context, user *store.User, viewerID int64) (bool, error) {
+	if !user.IsPrivate || viewerID == user.ID {
+		return true, nil
+	}
+	return app.store.Followers.IsFollowing(ctx, viewerID, user.ID)
+}
+
+type followListFunc func(ctx context.Context, userID, viewerID int64, fq store.PaginatedFeedQuery) ([]store.FollowListEntry, store.Cursors, error)
+
+func (app *application) followListResponse(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	fq := store.PaginatedFeedQuery{
+		Limit:    20,
+		MaxLimit: app.config.pages.maxLimit,
+		Offset:   0,
+		Sort:     "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	viewerID := getAuthUserID(r)
+	allowed, err := app.canSeeAccount(ctx, user, viewerID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if !allowed {
+		app.forbiddenResponse(w, r, errPrivateAccount)
+		return
+	}
+
+	entries, cursors, err := list(ctx, user.ID, viewerID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, entries, cursors); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 // ActivateUser godoc
@@ -119,9 +474,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 // FollowUser godoc
 //
 //	@Summary		Unfollow a user profile
-//	@Description	Unfollow a user profile by ID
+//	@Description	Unfollow a user profile by ID, or withdraw a pending follow request
 //	@Tags			users
-//	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{object}	string	"User unfollowed"
@@ -132,15 +486,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 //	@Router			/users/{id}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	followedUser := getUserFromContext(r)
-	// TODO: revert to auth userID from ctx
-	var payload FollowerUser
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
 
 	ctx := r.Context()
-	if err := app.store.Followers.Unfollow(ctx, followedUser.ID, payload.UserID); err != nil {
+	if err := app.store.Followers.Unfollow(ctx, getAuthUserID(r), followedUser.ID); err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundResponse(w, r, err)
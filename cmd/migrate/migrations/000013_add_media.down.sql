@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_attachments;
+
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,28 @@
+CREATE TABLE
+  IF NOT EXISTS media (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    user_id bigint NOT NULL,
+    storage_key text NOT NULL UNIQUE,
+    url text NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes bigint NOT NULL,
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+  );
+
+CREATE TABLE
+  IF NOT EXISTS post_attachments (
+    post_id bigint NOT NULL,
+    media_id bigint NOT NULL,
+    alt_text VARCHAR(1000) NOT NULL DEFAULT '',
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, media_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (media_id) REFERENCES media (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_post_attachments_media_id ON post_attachments (media_id);
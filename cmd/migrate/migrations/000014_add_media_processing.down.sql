@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS media_thumbnails;
+
+DROP INDEX IF EXISTS idx_media_status;
+
+ALTER TABLE media
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS width,
+DROP COLUMN IF EXISTS height,
+DROP COLUMN IF EXISTS blurhash,
+DROP COLUMN IF EXISTS processing_error;
@@ -0,0 +1,22 @@
+ALTER TABLE media
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ADD COLUMN width INT NOT NULL DEFAULT 0,
+ADD COLUMN height INT NOT NULL DEFAULT 0,
+ADD COLUMN blurhash VARCHAR(100) NOT NULL DEFAULT '',
+ADD COLUMN processing_error text NOT NULL DEFAULT '';
+
+CREATE TABLE
+  IF NOT EXISTS media_thumbnails (
+    media_id bigint NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    storage_key text NOT NULL,
+    url text NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    PRIMARY KEY (media_id, width),
+    FOREIGN KEY (media_id) REFERENCES media (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_media_status ON media (status)
+WHERE
+  status IN ('pending', 'processing');
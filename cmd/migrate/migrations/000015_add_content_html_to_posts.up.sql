@@ -0,0 +1,12 @@
+ALTER TABLE posts
+ADD COLUMN content_html text NOT NULL DEFAULT '';
+
+-- existing posts were written as plain text, escape them so they still
+-- render safely until they are next edited
+UPDATE posts
+SET
+  content_html = '<p>' || replace(
+    replace(replace(content, '&', '&amp;'), '<', '&lt;'),
+    '>',
+    '&gt;'
+  ) || '</p>';
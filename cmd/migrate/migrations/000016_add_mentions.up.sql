@@ -0,0 +1,23 @@
+CREATE TABLE
+  IF NOT EXISTS mentions (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    post_id bigint NOT NULL,
+    comment_id bigint,
+    author_id bigint NOT NULL,
+    mentioned_user_id bigint NOT NULL,
+    start_offset INT NOT NULL,
+    end_offset INT NOT NULL,
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+      FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+      FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE,
+      FOREIGN KEY (mentioned_user_id) REFERENCES users (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_mentions_mentioned_user_id ON mentions (mentioned_user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions (post_id);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_comment_id ON mentions (comment_id);
@@ -0,0 +1,7 @@
+ALTER TABLE posts
+ADD COLUMN explicit_tags VARCHAR(100)[];
+
+-- everything tagged so far was tagged explicitly
+UPDATE posts
+SET
+  explicit_tags = tags;
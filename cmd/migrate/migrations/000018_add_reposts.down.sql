@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_quote_of_id;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS quote_of_id,
+DROP COLUMN IF EXISTS is_quote;
+
+DROP TABLE IF EXISTS reposts;
@@ -0,0 +1,6 @@
+ALTER TABLE posts
+ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public' CONSTRAINT posts_visibility_check CHECK (
+  visibility IN ('public', 'followers', 'mentioned', 'private')
+);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
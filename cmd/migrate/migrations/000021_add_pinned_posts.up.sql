@@ -0,0 +1,13 @@
+CREATE TABLE
+  IF NOT EXISTS pinned_posts (
+    user_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    pinned_at timestamp
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      PRIMARY KEY (user_id, post_id),
+      FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+      FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_pinned_posts_post_id ON pinned_posts (post_id);
@@ -0,0 +1,49 @@
+CREATE TABLE
+  IF NOT EXISTS polls (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    post_id bigint NOT NULL UNIQUE,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at timestamp(0)
+    with
+      time zone NOT NULL,
+      created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+  );
+
+CREATE TABLE
+  IF NOT EXISTS poll_options (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    poll_id bigint NOT NULL,
+    position INT NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    UNIQUE (poll_id, position),
+    FOREIGN KEY (poll_id) REFERENCES polls (id) ON DELETE CASCADE
+  );
+
+-- one row per voter is what enforces a single vote per user, the options
+-- they picked are in poll_votes
+CREATE TABLE
+  IF NOT EXISTS poll_voters (
+    poll_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      PRIMARY KEY (poll_id, user_id),
+      FOREIGN KEY (poll_id) REFERENCES polls (id) ON DELETE CASCADE,
+      FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+  );
+
+CREATE TABLE
+  IF NOT EXISTS poll_votes (
+    poll_id bigint NOT NULL,
+    option_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    PRIMARY KEY (option_id, user_id),
+    FOREIGN KEY (option_id) REFERENCES poll_options (id) ON DELETE CASCADE,
+    FOREIGN KEY (poll_id, user_id) REFERENCES poll_voters (poll_id, user_id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_poll_user ON poll_votes (poll_id, user_id);
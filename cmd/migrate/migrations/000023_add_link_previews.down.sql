@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS link_preview_id;
+
+DROP TABLE IF EXISTS link_previews;
@@ -0,0 +1,17 @@
+CREATE TABLE
+  IF NOT EXISTS link_previews (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image_url TEXT NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    -- failed fetches are cached too so a broken url isn't hit on every post
+    failed BOOLEAN NOT NULL DEFAULT FALSE,
+    fetched_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW ()
+  );
+
+ALTER TABLE posts
+ADD COLUMN link_preview_id bigint REFERENCES link_previews (id) ON DELETE SET NULL;
@@ -0,0 +1,73 @@
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator')),
+ADD COLUMN suspended_at timestamp(0)
+with
+  time zone;
+
+ALTER TABLE posts
+ADD COLUMN hidden_at timestamp(0)
+with
+  time zone;
+
+ALTER TABLE comments
+ADD COLUMN hidden_at timestamp(0)
+with
+  time zone;
+
+CREATE TABLE
+  IF NOT EXISTS reports (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    reporter_id bigint NOT NULL,
+    target_type VARCHAR(20) NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id bigint NOT NULL,
+    reason VARCHAR(20) NOT NULL CHECK (
+      reason IN (
+        'spam',
+        'harassment',
+        'hate',
+        'violence',
+        'nudity',
+        'misinformation',
+        'other'
+      )
+    ),
+    details TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    resolution VARCHAR(20),
+    resolved_by bigint,
+    resolved_at timestamp(0)
+    with
+      time zone,
+      created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+      FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL
+  );
+
+-- a user can only have one open report per target
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_unique ON reports (reporter_id, target_type, target_id)
+WHERE
+  status = 'open';
+
+CREATE INDEX IF NOT EXISTS idx_reports_status_created_at ON reports (status, created_at);
+
+CREATE TABLE
+  IF NOT EXISTS moderation_actions (
+    id bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    report_id bigint,
+    moderator_id bigint,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('dismiss', 'hide', 'warn', 'suspend')),
+    target_type VARCHAR(20) NOT NULL,
+    target_id bigint NOT NULL,
+    target_user_id bigint,
+    note TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (report_id) REFERENCES reports (id) ON DELETE SET NULL,
+      FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL,
+      FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE SET NULL
+  );
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_target_user_id ON moderation_actions (target_user_id);
@@ -0,0 +1,29 @@
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+
+DROP INDEX IF EXISTS idx_comments_user_id_created_at;
+
+DELETE FROM reports
+WHERE
+  reason = 'filter';
+
+ALTER TABLE reports
+DROP CONSTRAINT IF EXISTS reports_reason_check;
+
+ALTER TABLE reports
+ADD CONSTRAINT reports_reason_check CHECK (
+  reason IN (
+    'spam',
+    'harassment',
+    'hate',
+    'violence',
+    'nudity',
+    'misinformation',
+    'other'
+  )
+);
+
+ALTER TABLE reports
+ALTER COLUMN reporter_id
+SET NOT NULL;
+
+DROP TABLE IF EXISTS content_filters;
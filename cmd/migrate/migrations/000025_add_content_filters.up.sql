@@ -0,0 +1,52 @@
+-- rules for the content filter chain, read at runtime so they can be tuned
+-- without a deploy
+CREATE TABLE
+  IF NOT EXISTS content_filters (
+    name VARCHAR(50) PRIMARY KEY,
+    position INT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('reject', 'hold')),
+    config JSONB NOT NULL DEFAULT '{}',
+    updated_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW ()
+  );
+
+INSERT INTO
+  content_filters (name, position, action, config)
+VALUES
+  ('banned_words', 1, 'reject', '{"words": []}'),
+  ('link_limit', 2, 'hold', '{"max_links": 3}'),
+  ('duplicate', 3, 'reject', '{"window_minutes": 60}'),
+  (
+    'velocity',
+    4,
+    'reject',
+    '{"max_items": 10, "window_minutes": 10}'
+  ) ON CONFLICT (name) DO NOTHING;
+
+-- content held by a filter is queued as a report without a reporter
+ALTER TABLE reports
+ALTER COLUMN reporter_id
+DROP NOT NULL;
+
+ALTER TABLE reports
+DROP CONSTRAINT IF EXISTS reports_reason_check;
+
+ALTER TABLE reports
+ADD CONSTRAINT reports_reason_check CHECK (
+  reason IN (
+    'spam',
+    'harassment',
+    'hate',
+    'violence',
+    'nudity',
+    'misinformation',
+    'other',
+    'filter'
+  )
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_user_id_created_at ON comments (user_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at);
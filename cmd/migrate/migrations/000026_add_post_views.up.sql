@@ -0,0 +1,10 @@
+-- impressions are aggregated per post and day by the api before they are
+-- written, so this stays small
+CREATE TABLE
+  IF NOT EXISTS post_views_daily (
+    post_id bigint NOT NULL,
+    day DATE NOT NULL,
+    views INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, day),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+  );
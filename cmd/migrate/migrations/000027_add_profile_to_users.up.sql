@@ -0,0 +1,10 @@
+ALTER TABLE users
+ADD COLUMN display_name VARCHAR(50) NOT NULL DEFAULT '',
+ADD COLUMN bio VARCHAR(160) NOT NULL DEFAULT '',
+ADD COLUMN avatar_media_id bigint REFERENCES media (id) ON DELETE SET NULL,
+ADD COLUMN location VARCHAR(100) NOT NULL DEFAULT '',
+ADD COLUMN website VARCHAR(200) NOT NULL DEFAULT '',
+ADD COLUMN birthday DATE,
+ADD COLUMN birthday_visibility VARCHAR(20) NOT NULL DEFAULT 'private' CONSTRAINT users_birthday_visibility_check CHECK (
+  birthday_visibility IN ('public', 'followers', 'private')
+);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_followers_follower_created_at;
+
+DROP INDEX IF EXISTS idx_followers_user_created_at;
+
+DROP TRIGGER IF EXISTS followers_update_counts ON followers;
+
+DROP FUNCTION IF EXISTS update_follow_counts ();
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS following_count,
+DROP COLUMN IF EXISTS followers_count;
@@ -0,0 +1,46 @@
+ALTER TABLE users
+ADD COLUMN followers_count INT NOT NULL DEFAULT 0,
+ADD COLUMN following_count INT NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET
+  followers_count = (
+    SELECT
+      COUNT(*)
+    FROM
+      followers f
+    WHERE
+      f.user_id = u.id
+  ),
+  following_count = (
+    SELECT
+      COUNT(*)
+    FROM
+      followers f
+    WHERE
+      f.follower_id = u.id
+  );
+
+-- the counters follow every insert and delete on followers, including
+-- cascades, so no code path can forget to update them
+CREATE OR REPLACE FUNCTION update_follow_counts () RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.user_id;
+    UPDATE users SET following_count = following_count + 1 WHERE id = NEW.follower_id;
+    RETURN NEW;
+  END IF;
+  UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.user_id;
+  UPDATE users SET following_count = following_count - 1 WHERE id = OLD.follower_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_update_counts
+AFTER INSERT
+OR DELETE ON followers FOR EACH ROW
+EXECUTE FUNCTION update_follow_counts ();
+
+CREATE INDEX IF NOT EXISTS idx_followers_user_created_at ON followers (user_id, created_at DESC, follower_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_created_at ON followers (follower_id, created_at DESC, user_id DESC);
@@ -0,0 +1,27 @@
+CREATE TABLE
+  IF NOT EXISTS blocks (
+    blocker_id bigint NOT NULL,
+    blocked_id bigint NOT NULL,
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      PRIMARY KEY (blocker_id, blocked_id),
+      CHECK (blocker_id <> blocked_id),
+      FOREIGN KEY (blocker_id) REFERENCES users (id) ON DELETE CASCADE,
+      FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks (blocked_id);
+
+CREATE TABLE
+  IF NOT EXISTS mutes (
+    muter_id bigint NOT NULL,
+    muted_id bigint NOT NULL,
+    created_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      PRIMARY KEY (muter_id, muted_id),
+      CHECK (muter_id <> muted_id),
+      FOREIGN KEY (muter_id) REFERENCES users (id) ON DELETE CASCADE,
+      FOREIGN KEY (muted_id) REFERENCES users (id) ON DELETE CASCADE
+  );
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS username_history;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS username_changed_at,
+ALTER COLUMN username TYPE VARCHAR(255);
@@ -0,0 +1,20 @@
+-- usernames are unique regardless of case, like emails
+ALTER TABLE users
+ALTER COLUMN username TYPE citext,
+ADD COLUMN username_changed_at timestamp(0)
+with
+  time zone;
+
+-- former usernames redirect to their owner and can't be claimed by anyone
+-- else
+CREATE TABLE
+  IF NOT EXISTS username_history (
+    username citext PRIMARY KEY,
+    user_id bigint NOT NULL,
+    changed_at timestamp(0)
+    with
+      time zone NOT NULL DEFAULT NOW (),
+      FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX IF NOT EXISTS idx_username_history_user_id ON username_history (user_id);
@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS followers_sync_timeline ON followers;
+
+DROP FUNCTION IF EXISTS sync_timeline_on_follow ();
+
+DROP INDEX IF EXISTS idx_reposts_fanout_pending;
+
+DROP INDEX IF EXISTS idx_posts_fanout_pending;
+
+ALTER TABLE reposts
+DROP COLUMN IF EXISTS fanned_out_at;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS fanned_out_at;
+
+DROP TABLE IF EXISTS timelines;
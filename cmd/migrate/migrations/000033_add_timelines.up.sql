@@ -0,0 +1,115 @@
+-- timelines hold the materialized home feed of each user: the posts of the
+-- accounts they follow and the reposts made by them. reposted_by is null for
+-- a post that is there on its own
+CREATE TABLE
+  IF NOT EXISTS timelines (
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    reposted_by bigint,
+    activity_at timestamp(0)
+    with
+      time zone NOT NULL,
+      FOREIGN KEY (reposted_by, post_id) REFERENCES reposts (user_id, post_id) ON DELETE CASCADE
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_timelines_user_post ON timelines (user_id, post_id)
+WHERE
+  reposted_by IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_timelines_user_post_repost ON timelines (user_id, post_id, reposted_by)
+WHERE
+  reposted_by IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_timelines_post_id ON timelines (post_id);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_reposted_by ON timelines (reposted_by, post_id)
+WHERE
+  reposted_by IS NOT NULL;
+
+-- posts and reposts wait with a null fanned_out_at until the fan-out worker
+-- copied them to the timelines of their followers. Existing rows are
+-- materialized below
+ALTER TABLE posts
+ADD COLUMN fanned_out_at timestamp(0) WITH time zone DEFAULT NOW ();
+
+ALTER TABLE posts
+ALTER COLUMN fanned_out_at
+DROP DEFAULT;
+
+ALTER TABLE reposts
+ADD COLUMN fanned_out_at timestamp(0) WITH time zone DEFAULT NOW ();
+
+ALTER TABLE reposts
+ALTER COLUMN fanned_out_at
+DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_posts_fanout_pending ON posts (id)
+WHERE
+  fanned_out_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_reposts_fanout_pending ON reposts (created_at)
+WHERE
+  fanned_out_at IS NULL;
+
+INSERT INTO
+  timelines (user_id, post_id, activity_at)
+SELECT
+  f.follower_id,
+  p.id,
+  p.created_at
+FROM
+  followers f
+  JOIN posts p ON p.user_id = f.user_id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO
+  timelines (user_id, post_id, reposted_by, activity_at)
+SELECT
+  f.follower_id,
+  r.post_id,
+  r.user_id,
+  r.created_at
+FROM
+  followers f
+  JOIN reposts r ON r.user_id = f.user_id
+ON CONFLICT DO NOTHING;
+
+-- a new follow brings the latest posts and reposts of the account into the
+-- follower's timeline, an unfollow takes them all out again. Like the follow
+-- counters this covers follow requests being accepted and blocks too
+CREATE OR REPLACE FUNCTION sync_timeline_on_follow () RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO timelines (user_id, post_id, activity_at)
+    SELECT NEW.follower_id, p.id, p.created_at
+    FROM posts p
+    WHERE p.user_id = NEW.user_id
+    ORDER BY p.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO timelines (user_id, post_id, reposted_by, activity_at)
+    SELECT NEW.follower_id, r.post_id, r.user_id, r.created_at
+    FROM reposts r
+    WHERE r.user_id = NEW.user_id
+    ORDER BY r.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+    RETURN NEW;
+  END IF;
+
+  DELETE FROM timelines t
+  USING posts p
+  WHERE t.user_id = OLD.follower_id AND t.reposted_by IS NULL
+  AND p.id = t.post_id AND p.user_id = OLD.user_id;
+
+  DELETE FROM timelines
+  WHERE user_id = OLD.follower_id AND reposted_by = OLD.user_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_sync_timeline
+AFTER INSERT
+OR DELETE ON followers FOR EACH ROW
+EXECUTE FUNCTION sync_timeline_on_follow ();
@@ -0,0 +1,11 @@
+-- media that became ready since has its url set by the processor already
+UPDATE media m
+SET
+  url = u.url
+FROM
+  media_unpublished_urls u
+WHERE
+  u.media_id = m.id
+  AND m.url = '';
+
+DROP TABLE IF EXISTS media_unpublished_urls;
@@ -0,0 +1,26 @@
+-- media urls are only published once the image pipeline is done with the
+-- file, which strips its metadata. The urls taken down here are kept so the
+-- down migration can put them back
+CREATE TABLE
+  IF NOT EXISTS media_unpublished_urls (
+    media_id bigint PRIMARY KEY REFERENCES media (id) ON DELETE CASCADE,
+    url text NOT NULL
+  );
+
+INSERT INTO
+  media_unpublished_urls (media_id, url)
+SELECT
+  id,
+  url
+FROM
+  media
+WHERE
+  status <> 'ready'
+  AND url <> ''
+ON CONFLICT DO NOTHING;
+
+UPDATE media
+SET
+  url = ''
+WHERE
+  status <> 'ready';
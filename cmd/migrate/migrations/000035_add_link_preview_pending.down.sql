@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_link_preview_pending;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS link_preview_pending;
@@ -0,0 +1,8 @@
+-- posts with a url wait here until the unfurler attached their preview, so
+-- the ones a restart interrupted are picked up again
+ALTER TABLE posts
+ADD COLUMN link_preview_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_link_preview_pending ON posts (id)
+WHERE
+  link_preview_pending;
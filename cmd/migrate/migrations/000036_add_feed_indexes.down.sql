@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at);
+
+DROP INDEX IF EXISTS idx_posts_user_created_at_id;
+
+DROP INDEX IF EXISTS idx_reposts_user_created_at;
+
+DROP INDEX IF EXISTS idx_timelines_user_activity;
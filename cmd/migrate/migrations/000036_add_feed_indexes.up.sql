@@ -0,0 +1,10 @@
+-- every source of the home feed is read in (time, post id) order from the
+-- cursor on, so each of them needs an index in that order
+CREATE INDEX IF NOT EXISTS idx_timelines_user_activity ON timelines (user_id, activity_at, post_id);
+
+CREATE INDEX IF NOT EXISTS idx_reposts_user_created_at ON reposts (user_id, created_at, post_id);
+
+-- covers what idx_posts_user_id_created_at was used for
+CREATE INDEX IF NOT EXISTS idx_posts_user_created_at_id ON posts (user_id, created_at, id);
+
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
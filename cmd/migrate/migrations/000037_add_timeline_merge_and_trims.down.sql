@@ -0,0 +1,43 @@
+CREATE OR REPLACE FUNCTION sync_timeline_on_follow () RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO timelines (user_id, post_id, activity_at)
+    SELECT NEW.follower_id, p.id, p.created_at
+    FROM posts p
+    WHERE p.user_id = NEW.user_id
+    ORDER BY p.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO timelines (user_id, post_id, reposted_by, activity_at)
+    SELECT NEW.follower_id, r.post_id, r.user_id, r.created_at
+    FROM reposts r
+    WHERE r.user_id = NEW.user_id
+    ORDER BY r.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+    RETURN NEW;
+  END IF;
+
+  DELETE FROM timelines t
+  USING posts p
+  WHERE t.user_id = OLD.follower_id AND t.reposted_by IS NULL
+  AND p.id = t.post_id AND p.user_id = OLD.user_id;
+
+  DELETE FROM timelines
+  WHERE user_id = OLD.follower_id AND reposted_by = OLD.user_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS timeline_trims;
+
+DROP INDEX IF EXISTS idx_reposts_merge_on_read;
+
+DROP INDEX IF EXISTS idx_posts_merge_on_read;
+
+ALTER TABLE reposts
+DROP COLUMN IF EXISTS merge_on_read;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS merge_on_read;
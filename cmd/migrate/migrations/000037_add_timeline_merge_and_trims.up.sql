@@ -0,0 +1,117 @@
+-- merge_on_read marks the posts and reposts that were not fanned out because
+-- their author had too many followers at the time. Feeds merge them in when
+-- they are read, however the author's follower count changes later
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS merge_on_read boolean NOT NULL DEFAULT false;
+
+ALTER TABLE reposts
+ADD COLUMN IF NOT EXISTS merge_on_read boolean NOT NULL DEFAULT false;
+
+-- the fan-out didn't record what it skipped so far. Anything a follower is
+-- missing is merged on read, which at worst shows a post that was trimmed
+UPDATE posts p
+SET
+  merge_on_read = true
+WHERE
+  p.fanned_out_at IS NOT NULL
+  AND EXISTS (
+    SELECT
+      1
+    FROM
+      followers f
+    WHERE
+      f.user_id = p.user_id
+      AND NOT EXISTS (
+        SELECT
+          1
+        FROM
+          timelines t
+        WHERE
+          t.user_id = f.follower_id
+          AND t.post_id = p.id
+          AND t.reposted_by IS NULL
+      )
+  );
+
+UPDATE reposts r
+SET
+  merge_on_read = true
+WHERE
+  r.fanned_out_at IS NOT NULL
+  AND EXISTS (
+    SELECT
+      1
+    FROM
+      followers f
+    WHERE
+      f.user_id = r.user_id
+      AND NOT EXISTS (
+        SELECT
+          1
+        FROM
+          timelines t
+        WHERE
+          t.user_id = f.follower_id
+          AND t.post_id = r.post_id
+          AND t.reposted_by = r.user_id
+      )
+  );
+
+CREATE INDEX IF NOT EXISTS idx_posts_merge_on_read ON posts (user_id, created_at, id)
+WHERE
+  merge_on_read;
+
+CREATE INDEX IF NOT EXISTS idx_reposts_merge_on_read ON reposts (user_id, created_at, post_id)
+WHERE
+  merge_on_read;
+
+-- timeline_trims lists the timelines that grew since they were last
+-- trimmed, so trimming doesn't have to go through every timeline
+CREATE TABLE
+  IF NOT EXISTS timeline_trims (
+    user_id bigint PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE
+  );
+
+INSERT INTO
+  timeline_trims (user_id)
+SELECT DISTINCT
+  user_id
+FROM
+  timelines
+ON CONFLICT DO NOTHING;
+
+-- the backfill of a new follow grows the timeline too
+CREATE OR REPLACE FUNCTION sync_timeline_on_follow () RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO timelines (user_id, post_id, activity_at)
+    SELECT NEW.follower_id, p.id, p.created_at
+    FROM posts p
+    WHERE p.user_id = NEW.user_id
+    ORDER BY p.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO timelines (user_id, post_id, reposted_by, activity_at)
+    SELECT NEW.follower_id, r.post_id, r.user_id, r.created_at
+    FROM reposts r
+    WHERE r.user_id = NEW.user_id
+    ORDER BY r.created_at DESC
+    LIMIT 200
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO timeline_trims (user_id) VALUES (NEW.follower_id)
+    ON CONFLICT DO NOTHING;
+    RETURN NEW;
+  END IF;
+
+  DELETE FROM timelines t
+  USING posts p
+  WHERE t.user_id = OLD.follower_id AND t.reposted_by IS NULL
+  AND p.id = t.post_id AND p.user_id = OLD.user_id;
+
+  DELETE FROM timelines
+  WHERE user_id = OLD.follower_id AND reposted_by = OLD.user_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
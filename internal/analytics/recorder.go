@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	FlushInterval time.Duration
+	// DedupWindow is how long repeated views of a post by the same viewer
+	// count as one
+	DedupWindow time.Duration
+}
+
+type viewKey struct {
+	postID   int64
+	viewerID int64
+}
+
+type dayKey struct {
+	postID int64
+	day    time.Time
+}
+
+// Recorder counts post impressions in memory and writes them out in
+// batches, so recording a view never waits on the database.
+type Recorder struct {
+	store  store.Storage
+	logger *zap.SugaredLogger
+	config Config
+
+	mu      sync.Mutex
+	seen    map[viewKey]time.Time
+	pending map[dayKey]int
+
+	// done is closed once the final flush has finished
+	done chan struct{}
+}
+
+func NewRecorder(store store.Storage, logger *zap.SugaredLogger, config Config) *Recorder {
+	return &Recorder{
+		store:   store,
+		logger:  logger,
+		config:  config,
+		seen:    make(map[viewKey]time.Time),
+		pending: make(map[dayKey]int),
+		done:    make(chan struct{}),
+	}
+}
+
+// Record counts a view of postID by viewerID. Authors viewing their own
+// posts and repeated views within the dedup window are ignored.
+func (rec *Recorder) Record(viewerID, postID, authorID int64) {
+	if viewerID == authorID {
+		return
+	}
+	now := time.Now().UTC()
+	key := viewKey{postID: postID, viewerID: viewerID}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if last, ok := rec.seen[key]; ok && now.Sub(last) < rec.config.DedupWindow {
+		return
+	}
+	rec.seen[key] = now
+	rec.pending[dayKey{postID: postID, day: now.Truncate(24 * time.Hour)}]++
+}
+
+// Start flushes pending views every flush interval until ctx is cancelled,
+// then flushes one last time. Use Wait to block until that flush is done.
+func (rec *Recorder) Start(ctx context.Context) {
+	go func() {
+		defer close(rec.done)
+		ticker := time.NewTicker(rec.config.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				rec.flush(context.Background())
+				return
+			case <-ticker.C:
+				rec.flush(ctx)
+			}
+		}
+	}()
+}
+
+// Wait blocks until the recorder has stopped and written out the views it
+// was holding, or until ctx is done.
+func (rec *Recorder) Wait(ctx context.Context) error {
+	select {
+	case <-rec.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (rec *Recorder) flush(ctx context.Context) {
+	rec.mu.Lock()
+	pending := rec.pending
+	rec.pending = make(map[dayKey]int)
+	cutoff := time.Now().UTC().Add(-rec.config.DedupWindow)
+	for k, t := range rec.seen {
+		if t.Before(cutoff) {
+			delete(rec.seen, k)
+		}
+	}
+	rec.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	views := make([]store.PostViews, 0, len(pending))
+	for k, n := range pending {
+		views = append(views, store.PostViews{PostID: k.postID, Day: k.day, Views: n})
+	}
+	if err := rec.store.Analytics.AddViews(ctx, views); err != nil {
+		// the counts are dropped rather than retried so a database outage
+		// can't make the buffer grow without bound
+		rec.logger.Errorw("failed to flush post views", "posts", len(views), "error", err.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+type fakeAnalytics struct {
+	mu    sync.Mutex
+	views map[int64]int
+}
+
+func (f *fakeAnalytics) AddViews(ctx context.Context, views []store.PostViews) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, v := range views {
+		f.views[v.PostID] += v.Views
+	}
+	return nil
+}
+
+func (f *fakeAnalytics) GetForAuthor(ctx context.Context, userID int64, from, to time.Time) ([]store.PostAnalytics, error) {
+	return nil, nil
+}
+
+func TestRecorderFlushesOnShutdown(t *testing.T) {
+	fake := &fakeAnalytics{views: make(map[int64]int)}
+	rec := NewRecorder(store.Storage{Analytics: fake}, zap.NewNop().Sugar(), Config{
+		// long enough that only the final flush can write the views
+		FlushInterval: time.Hour,
+		DedupWindow:   time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec.Start(ctx)
+
+	rec.Record(2, 10, 1)
+	rec.Record(2, 10, 1) // inside the dedup window
+	rec.Record(3, 10, 1)
+	rec.Record(1, 10, 1) // the author
+	rec.Record(2, 11, 1)
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := rec.Wait(waitCtx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.views[10] != 2 || fake.views[11] != 1 {
+		t.Errorf("got views %v, want post 10 seen twice and post 11 once", fake.views)
+	}
+}
+
+func TestRecorderWaitRespectsContext(t *testing.T) {
+	rec := NewRecorder(store.Storage{}, zap.NewNop().Sugar(), Config{FlushInterval: time.Hour})
+	rec.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := rec.Wait(ctx); err == nil {
+		t.Error("Wait returned before the recorder was stopped")
+	}
+}
@@ -0,0 +1,103 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRoundTrip runs the BlobStore contract against store: what is put can be
+// read back, deleting is idempotent and missing keys are ErrNotFound.
+func testRoundTrip(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	key := fmt.Sprintf("test/%d/hello.txt", time.Now().UnixNano())
+	content := []byte("hello gophers")
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Get returned %q, want %q", got, content)
+	}
+
+	if !strings.HasSuffix(store.URL(key), "/"+key) {
+		t.Errorf("URL(%q) = %q, want it to end with the key", key, store.URL(key))
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob returned %v, want nil", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/v1/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, store)
+}
+
+func TestLocalStoreKeysStayInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "http://localhost:8080/v1/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.path("../../etc/passwd"); !strings.HasPrefix(got, dir) {
+		t.Errorf("path escaped the store dir: %s", got)
+	}
+}
+
+// TestS3Store runs against an S3 compatible server such as the MinIO from
+// docker-compose.yaml. It is skipped unless TEST_S3_ENDPOINT is set, e.g.
+// TEST_S3_ENDPOINT=localhost:9000.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := NewS3Store(ctx, S3Config{
+		Endpoint:  endpoint,
+		AccessKey: getenv("TEST_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: getenv("TEST_S3_SECRET_KEY", "minioadmin"),
+		Bucket:    getenv("TEST_S3_BUCKET", "media-test"),
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	testRoundTrip(t, store)
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
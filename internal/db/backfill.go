@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"github.com/temideewan/go-social/internal/store"
+)
+
+const backfillBatchSize = 500
+
+// BackfillHashtags merges the hashtags of every existing post into its tags.
+// It is safe to run more than once.
+func BackfillHashtags(store store.Storage) {
+	ctx := context.Background()
+
+	var lastID int64
+	total := 0
+	for {
+		nextID, updated, err := store.Posts.BackfillTags(ctx, lastID, backfillBatchSize)
+		if err != nil {
+			log.Println("Error backfilling hashtags after post", lastID, ":", err)
+			return
+		}
+		if nextID == lastID {
+			break
+		}
+		lastID = nextID
+		total += updated
+	}
+	log.Println("Hashtag backfill complete, updated", total, "posts")
+}
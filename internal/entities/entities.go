@@ -0,0 +1,90 @@
+package entities
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxMentionLength = 100
+	maxHashtagLength = 100
+)
+
+// Entity is a span of text such as @alice12. Start and End are character
+// (rune) offsets into the source and include the leading sigil, Text does
+// not.
+type Entity struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Mentions finds @username references in s. An @ preceded by a word
+// character, as in an email address, is not a mention.
+func Mentions(s string) []Entity {
+	return scan(s, '@', isUsernameRune, maxMentionLength)
+}
+
+// Hashtags finds #tag references in s. Tags made only of digits, like #1,
+// are skipped.
+func Hashtags(s string) []Entity {
+	found := []Entity{}
+	for _, e := range scan(s, '#', isHashtagRune, maxHashtagLength) {
+		if strings.IndexFunc(e.Text, unicode.IsLetter) >= 0 {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+
+// URLs finds http and https links in s, leaving out trailing punctuation
+// that most likely ends the sentence rather than the url. Text holds the
+// whole url.
+func URLs(s string) []Entity {
+	found := []Entity{}
+	for _, loc := range urlPattern.FindAllStringIndex(s, -1) {
+		u := strings.TrimRight(s[loc[0]:loc[1]], ".,;:!?*_~")
+		if strings.HasSuffix(u, "://") {
+			continue
+		}
+		start := utf8.RuneCountInString(s[:loc[0]])
+		found = append(found, Entity{Text: u, Start: start, End: start + utf8.RuneCountInString(u)})
+	}
+	return found
+}
+
+func isHashtagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isUsernameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func scan(s string, sigil rune, isEntityRune func(rune) bool, maxLen int) []Entity {
+	runes := []rune(s)
+	found := []Entity{}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != sigil {
+			continue
+		}
+		// skip emails, repeated sigils and url paths or fragments
+		if i > 0 && (isEntityRune(runes[i-1]) || runes[i-1] == sigil || runes[i-1] == '/') {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isEntityRune(runes[j]) {
+			j++
+		}
+		if n := j - i - 1; n > 0 && n <= maxLen {
+			found = append(found, Entity{Text: string(runes[i+1 : j]), Start: i, End: j})
+		}
+		i = j - 1
+	}
+	return found
+}
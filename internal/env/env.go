@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 func GetString(key, fallback string) string {
@@ -25,3 +26,35 @@ func GetInt(key string, fallback int) int {
 
 	return valAsInt
 }
+
+func GetBool(key string, fallback bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	valAsBool, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+
+	return valAsBool
+}
+
+// GetIntSlice reads a comma separated list of ints such as "160,480,1080".
+func GetIntSlice(key string, fallback []int) []int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parts := strings.Split(val, ",")
+	ints := make([]int, 0, len(parts))
+	for _, part := range parts {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fallback
+		}
+		ints = append(ints, i)
+	}
+
+	return ints
+}
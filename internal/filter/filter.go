@@ -0,0 +1,168 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	KindPost    = store.ReportTargetPost
+	KindComment = store.ReportTargetComment
+)
+
+type Decision string
+
+const (
+	Allow  Decision = "allow"
+	Reject Decision = store.FilterActionReject
+	Hold   Decision = store.FilterActionHold
+)
+
+// Content is a post or comment about to be written.
+type Content struct {
+	UserID int64
+	Kind   string
+	Title  string
+	Body   string
+}
+
+func (c Content) text() string {
+	if c.Title == "" {
+		return c.Body
+	}
+	return c.Title + "\n" + c.Body
+}
+
+// Result is the outcome of running the chain. Filter and Reason are set
+// when a filter rejected or held the content.
+type Result struct {
+	Decision Decision
+	Filter   string
+	Reason   string
+}
+
+// Filter checks content against a single rule. It returns the reason the
+// content breaks the rule, or "" to let it through. What happens to flagged
+// content is decided by the action of the rule.
+type Filter interface {
+	Check(ctx context.Context, c Content) (string, error)
+}
+
+// Factory builds a filter from the JSON config of its rule.
+type Factory func(config json.RawMessage, store store.Storage) (Filter, error)
+
+var registry = map[string]Factory{
+	"banned_words": newBannedWords,
+	"link_limit":   newLinkLimit,
+	"duplicate":    newDuplicate,
+	"velocity":     newVelocity,
+}
+
+// Register makes a filter available to rules under name. It is meant to be
+// called during initialisation.
+func Register(name string, factory Factory) {
+	registry[name] = factory
+}
+
+type step struct {
+	name   string
+	action string
+	filter Filter
+}
+
+// Chain runs the enabled filters in order. Rules are read from the
+// content_filters table and reloaded every refresh interval, so they can be
+// changed while the server runs.
+type Chain struct {
+	store   store.Storage
+	logger  *zap.SugaredLogger
+	refresh time.Duration
+
+	mu       sync.Mutex
+	steps    []step
+	loadedAt time.Time
+}
+
+func NewChain(store store.Storage, logger *zap.SugaredLogger, refresh time.Duration) *Chain {
+	return &Chain{
+		store:   store,
+		logger:  logger,
+		refresh: refresh,
+	}
+}
+
+// Check runs content through the chain. The first filter that flags the
+// content decides the result.
+func (c *Chain) Check(ctx context.Context, content Content) (Result, error) {
+	steps, err := c.load(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Decision: Allow}
+	for _, s := range steps {
+		reason, err := s.filter.Check(ctx, content)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s filter: %w", s.name, err)
+		}
+		if reason != "" {
+			result = Result{Decision: Decision(s.action), Filter: s.name, Reason: reason}
+			break
+		}
+	}
+
+	c.logger.Infow("content filter decision",
+		"request_id", middleware.GetReqID(ctx),
+		"user_id", content.UserID,
+		"kind", content.Kind,
+		"decision", result.Decision,
+		"filter", result.Filter,
+		"reason", result.Reason,
+	)
+	return result, nil
+}
+
+func (c *Chain) load(ctx context.Context) ([]step, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.steps != nil && time.Since(c.loadedAt) < c.refresh {
+		return c.steps, nil
+	}
+
+	rules, err := c.store.ContentFilters.GetRules(ctx)
+	if err != nil {
+		if c.steps != nil {
+			// keep filtering with the rules we have rather than failing writes
+			c.logger.Errorw("failed to reload content filter rules", "error", err.Error())
+			return c.steps, nil
+		}
+		return nil, err
+	}
+
+	steps := make([]step, 0, len(rules))
+	for _, rule := range rules {
+		factory, ok := registry[rule.Name]
+		if !ok {
+			c.logger.Warnw("unknown content filter", "filter", rule.Name)
+			continue
+		}
+		f, err := factory(rule.Config, c.store)
+		if err != nil {
+			c.logger.Errorw("invalid content filter config", "filter", rule.Name, "error", err.Error())
+			continue
+		}
+		steps = append(steps, step{name: rule.Name, action: rule.Action, filter: f})
+	}
+
+	c.steps = steps
+	c.loadedAt = time.Now()
+	return steps, nil
+}
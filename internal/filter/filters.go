@@ -0,0 +1,138 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/temideewan/go-social/internal/entities"
+	"github.com/temideewan/go-social/internal/store"
+)
+
+// bannedWords flags content containing any of the configured words or
+// phrases, matched case-insensitively on whole words.
+type bannedWords struct {
+	phrases []string
+}
+
+func newBannedWords(config json.RawMessage, _ store.Storage) (Filter, error) {
+	var cfg struct {
+		Words []string `json:"words"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, err
+	}
+
+	f := &bannedWords{}
+	for _, w := range cfg.Words {
+		if p := normalizeWords(w); p != "" {
+			f.phrases = append(f.phrases, " "+p+" ")
+		}
+	}
+	return f, nil
+}
+
+func (f *bannedWords) Check(_ context.Context, c Content) (string, error) {
+	text := " " + normalizeWords(c.text()) + " "
+	for _, p := range f.phrases {
+		if strings.Contains(text, p) {
+			return "contains a banned word", nil
+		}
+	}
+	return "", nil
+}
+
+// normalizeWords lowercases s and joins its words with single spaces.
+func normalizeWords(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	return strings.Join(words, " ")
+}
+
+// linkLimit flags content with more than the configured number of links.
+type linkLimit struct {
+	MaxLinks int `json:"max_links"`
+}
+
+func newLinkLimit(config json.RawMessage, _ store.Storage) (Filter, error) {
+	f := &linkLimit{}
+	if err := json.Unmarshal(config, f); err != nil {
+		return nil, err
+	}
+	if f.MaxLinks < 0 {
+		return nil, errors.New("max_links can't be negative")
+	}
+	return f, nil
+}
+
+func (f *linkLimit) Check(_ context.Context, c Content) (string, error) {
+	if len(entities.URLs(c.text())) > f.MaxLinks {
+		return fmt.Sprintf("contains more than %d links", f.MaxLinks), nil
+	}
+	return "", nil
+}
+
+// duplicate flags content the user already wrote within the window.
+type duplicate struct {
+	store         store.Storage
+	WindowMinutes int `json:"window_minutes"`
+}
+
+func newDuplicate(config json.RawMessage, store store.Storage) (Filter, error) {
+	f := &duplicate{store: store}
+	if err := json.Unmarshal(config, f); err != nil {
+		return nil, err
+	}
+	if f.WindowMinutes <= 0 {
+		return nil, errors.New("window_minutes must be positive")
+	}
+	return f, nil
+}
+
+func (f *duplicate) Check(ctx context.Context, c Content) (string, error) {
+	since := time.Now().Add(-time.Duration(f.WindowMinutes) * time.Minute)
+	found, err := f.store.ContentFilters.HasDuplicate(ctx, c.UserID, c.Kind, c.Body, since)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return fmt.Sprintf("you already posted this in the last %d minutes", f.WindowMinutes), nil
+	}
+	return "", nil
+}
+
+// velocity flags users writing more than MaxItems posts, or comments, within
+// the window.
+type velocity struct {
+	store         store.Storage
+	MaxItems      int `json:"max_items"`
+	WindowMinutes int `json:"window_minutes"`
+}
+
+func newVelocity(config json.RawMessage, store store.Storage) (Filter, error) {
+	f := &velocity{store: store}
+	if err := json.Unmarshal(config, f); err != nil {
+		return nil, err
+	}
+	if f.MaxItems <= 0 || f.WindowMinutes <= 0 {
+		return nil, errors.New("max_items and window_minutes must be positive")
+	}
+	return f, nil
+}
+
+func (f *velocity) Check(ctx context.Context, c Content) (string, error) {
+	since := time.Now().Add(-time.Duration(f.WindowMinutes) * time.Minute)
+	count, err := f.store.ContentFilters.CountRecent(ctx, c.UserID, c.Kind, since)
+	if err != nil {
+		return "", err
+	}
+	if count >= f.MaxItems {
+		return "you are posting too fast, try again later", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,194 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidImage = errors.New("invalid or truncated image")
+
+// StripMetadata removes EXIF (including GPS), XMP, IPTC and comment blocks
+// without re-encoding the pixel data. Formats without a stripper are
+// returned unchanged.
+func StripMetadata(data []byte, mimeType string) ([]byte, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	default:
+		return data, nil
+	}
+}
+
+// JPEGOrientation returns the EXIF orientation (1-8) of a jpeg, or 1 when
+// it has none.
+func JPEGOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(bo.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(bo.Uint16(tiff[ifd:]))
+	for k := 0; k < entries; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if bo.Uint16(tiff[e:]) == 0x0112 {
+			o := int(bo.Uint16(tiff[e+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errInvalidImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	i := 2
+	for i+2 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, errInvalidImage
+		}
+		marker := data[i+1]
+		switch marker {
+		case 0xFF: // fill byte
+			i++
+			continue
+		case 0xDA, 0xD9: // start of scan / end of image, the rest is pixel data
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		if i+4 > len(data) {
+			return nil, errInvalidImage
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		// APP1 holds EXIF and XMP, APP13 holds IPTC and COM holds comments
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return nil, errInvalidImage
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errInvalidImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[i:end])
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+	return nil, errInvalidImage
+}
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	i := 12
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2 // chunks are padded to an even size
+		if size < 0 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if size > 0 {
+				// clear the EXIF and XMP presence flags
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,235 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/temideewan/go-social/internal/blob"
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels guards against decompression bombs, roughly a 50 megapixel image.
+const maxPixels = 50_000_000
+
+var ErrQueueFull = errors.New("image processing queue is full")
+
+type Config struct {
+	ThumbnailWidths []int
+	Workers         int
+	QueueSize       int
+	Timeout         time.Duration
+}
+
+// Processor strips metadata, generates thumbnails and computes blurhash
+// placeholders for uploaded images in the background.
+type Processor struct {
+	store  store.Storage
+	blob   blob.BlobStore
+	logger *zap.SugaredLogger
+	config Config
+	jobs   chan int64
+}
+
+func NewProcessor(store store.Storage, blob blob.BlobStore, logger *zap.SugaredLogger, config Config) *Processor {
+	return &Processor{
+		store:  store,
+		blob:   blob,
+		logger: logger,
+		config: config,
+		jobs:   make(chan int64, config.QueueSize),
+	}
+}
+
+// IsProcessable reports whether the pipeline handles the given mime type.
+func IsProcessable(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Sanitize drops the metadata of an uploaded image, EXIF and GPS data
+// included. It runs before the upload is stored so the original is never
+// served. A rotated jpeg is re-encoded upright since dropping the EXIF block
+// also drops its orientation.
+func Sanitize(data []byte, mimeType string) ([]byte, error) {
+	if o := JPEGOrientation(data); mimeType == "image/jpeg" && o > 1 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Width*cfg.Height > maxPixels {
+			return nil, fmt.Errorf("image is too large: %dx%d", cfg.Width, cfg.Height)
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		clean, _, err := Encode(ApplyOrientation(img, o))
+		return clean, err
+	}
+	return StripMetadata(data, mimeType)
+}
+
+// Start launches the workers and requeues media left unprocessed by a
+// previous run. Workers stop when ctx is cancelled.
+func (p *Processor) Start(ctx context.Context) {
+	for i := 0; i < p.config.Workers; i++ {
+		go p.work(ctx)
+	}
+
+	go func() {
+		ids, err := p.store.Media.GetUnprocessed(ctx)
+		if err != nil {
+			p.logger.Errorw("failed to load unprocessed media", "error", err.Error())
+			return
+		}
+		for _, id := range ids {
+			select {
+			case p.jobs <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Enqueue schedules media for processing without blocking the caller.
+func (p *Processor) Enqueue(mediaID int64) error {
+	select {
+	case p.jobs <- mediaID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (p *Processor) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.jobs:
+			jobCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+			if err := p.process(jobCtx, id); err != nil {
+				p.logger.Errorw("media processing failed", "media_id", id, "error", err.Error())
+				if err := p.store.Media.SetStatus(ctx, id, store.MediaStatusFailed, err.Error()); err != nil {
+					p.logger.Errorw("failed to update media status", "media_id", id, "error", err.Error())
+				}
+			}
+			cancel()
+		}
+	}
+}
+
+func (p *Processor) process(ctx context.Context, id int64) error {
+	media, err := p.store.Media.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if media.Status == store.MediaStatusReady {
+		return nil
+	}
+	if err := p.store.Media.SetStatus(ctx, id, store.MediaStatusProcessing, ""); err != nil {
+		return err
+	}
+
+	rc, err := p.blob.Get(ctx, media.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return fmt.Errorf("image is too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	// uploads are sanitized before they are stored, this only catches media
+	// stored before that was the case
+	clean, err := Sanitize(data, media.MimeType)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(clean, data) {
+		if err := p.blob.Put(ctx, media.StorageKey, bytes.NewReader(clean), int64(len(clean)), media.MimeType); err != nil {
+			return err
+		}
+		media.Size = int64(len(clean))
+	}
+	img, _, err := image.Decode(bytes.NewReader(clean))
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	media.Width, media.Height = bounds.Dx(), bounds.Dy()
+
+	media.Thumbnails = nil
+	for _, width := range p.config.ThumbnailWidths {
+		if width >= media.Width {
+			continue
+		}
+		thumb, err := p.thumbnail(ctx, media.StorageKey, img, width)
+		if err != nil {
+			return err
+		}
+		media.Thumbnails = append(media.Thumbnails, *thumb)
+	}
+
+	// the hash only needs a handful of pixels, encode from a tiny copy
+	media.Blurhash, err = blurhash.Encode(4, 3, Resize(img, min(32, media.Width)))
+	if err != nil {
+		return err
+	}
+
+	// the url is only handed out once the media is ready
+	media.URL = p.blob.URL(media.StorageKey)
+	return p.store.Media.CompleteProcessing(ctx, media)
+}
+
+func (p *Processor) thumbnail(ctx context.Context, key string, img image.Image, width int) (*store.Thumbnail, error) {
+	resized := Resize(img, width)
+	data, mimeType, err := Encode(resized)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".jpg"
+	if mimeType == "image/png" {
+		ext = ".png"
+	}
+	thumbKey := fmt.Sprintf("%s_%dw%s", strings.TrimSuffix(key, path.Ext(key)), width, ext)
+	if err := p.blob.Put(ctx, thumbKey, bytes.NewReader(data), int64(len(data)), mimeType); err != nil {
+		return nil, err
+	}
+
+	return &store.Thumbnail{
+		Width:      width,
+		Height:     resized.Bounds().Dy(),
+		StorageKey: thumbKey,
+		URL:        p.blob.URL(thumbKey),
+		MimeType:   mimeType,
+	}, nil
+}
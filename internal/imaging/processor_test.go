@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegWithExif encodes a w by h jpeg with an APP1 block holding the given
+// orientation and a fake GPS tag.
+func jpegWithExif(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	// little endian TIFF with one IFD of two entries: orientation and the
+	// GPS IFD pointer
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = append(tiff, 0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0x00, 0x00)
+	tiff = append(tiff, 0x25, 0x88, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	out := append([]byte{}, encoded[:2]...)
+	out = append(out, app1...)
+	return append(out, encoded[2:]...)
+}
+
+func TestSanitizeStripsExif(t *testing.T) {
+	data := jpegWithExif(t, 4, 2, 1)
+	if !bytes.Contains(data, []byte("Exif\x00\x00")) {
+		t.Fatal("test image has no EXIF block")
+	}
+
+	clean, err := Sanitize(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(clean, []byte("Exif\x00\x00")) {
+		t.Error("EXIF block survived sanitizing")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 4 || cfg.Height != 2 {
+		t.Errorf("got a %dx%d image, want 4x2", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSanitizeRotatesJPEG(t *testing.T) {
+	// orientation 6 is rotated 90 degrees clockwise
+	data := jpegWithExif(t, 4, 2, 6)
+	if o := JPEGOrientation(data); o != 6 {
+		t.Fatalf("test image has orientation %d, want 6", o)
+	}
+
+	clean, err := Sanitize(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(clean, []byte("Exif\x00\x00")) {
+		t.Error("EXIF block survived sanitizing")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 2 || cfg.Height != 4 {
+		t.Errorf("got a %dx%d image, want it upright at 2x4", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSanitizeRejectsBrokenImages(t *testing.T) {
+	if _, err := Sanitize([]byte("not a jpeg"), "image/jpeg"); err == nil {
+		t.Error("sanitizing garbage succeeded")
+	}
+}
@@ -0,0 +1,90 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.Linkify),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(linkRelTransformer{}, 100)),
+		),
+	)
+
+	// policy only lets through the subset we support: links, emphasis,
+	// code blocks and lists. Anything else is reduced to its text.
+	policy = newPolicy()
+
+	textPolicy = bluemonday.StrictPolicy()
+)
+
+const linkRel = "nofollow ugc noopener"
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "em", "strong", "code", "pre", "ul", "ol", "li")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowStandardURLs()
+	p.AllowURLSchemes("http", "https", "mailto")
+	return p
+}
+
+// linkRelTransformer marks every user supplied link, linkified URLs included,
+// as nofollow ugc, and noopener in case a client opens it in a new window.
+type linkRelTransformer struct{}
+
+func (linkRelTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			n.SetAttributeString("rel", []byte(linkRel))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Render converts markdown source to sanitized HTML.
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(policy.Sanitize(buf.String())), nil
+}
+
+// VisibleText returns the text a reader would see once source is rendered,
+// without any markup.
+func VisibleText(source string) (string, error) {
+	rendered, err := Render(source)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(html.UnescapeString(textPolicy.Sanitize(rendered))), nil
+}
+
+// VisibleLength counts the characters of the visible text of source.
+func VisibleLength(source string) (int, error) {
+	visible, err := VisibleText(source)
+	if err != nil {
+		return 0, err
+	}
+	return utf8.RuneCountInString(visible), nil
+}
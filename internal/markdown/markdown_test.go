@@ -0,0 +1,94 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		without []string
+	}{
+		{
+			name:    "script tags are stripped",
+			source:  "hi <script>alert(1)</script> there",
+			want:    "<p>hi alert(1) there</p>",
+			without: []string{"<script"},
+		},
+		{
+			name:    "event handler attributes are stripped",
+			source:  `<a href="https://example.com" onclick="alert(1)">x</a> <img src=x onerror=alert(1)>`,
+			without: []string{"onclick", "onerror", "<img"},
+		},
+		{
+			name:    "javascript links are dropped",
+			source:  "[click](javascript:alert(1))",
+			want:    `<p><a rel="nofollow ugc noopener">click</a></p>`,
+			without: []string{"javascript:", "href"},
+		},
+		{
+			name:   "links are nofollow",
+			source: "[site](https://example.com)",
+			want:   `<p><a href="https://example.com" rel="nofollow ugc noopener">site</a></p>`,
+		},
+		{
+			name:   "bare urls are linkified and nofollow",
+			source: "see https://example.com now",
+			want:   `<p>see <a href="https://example.com" rel="nofollow ugc noopener">https://example.com</a> now</p>`,
+		},
+		{
+			name:   "emphasis and code are kept",
+			source: "**bold** _em_ `code`",
+			want:   "<p><strong>bold</strong> <em>em</em> <code>code</code></p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+			for _, s := range tt.without {
+				if strings.Contains(got, s) {
+					t.Errorf("Render(%q) = %q, it shouldn't contain %q", tt.source, got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestVisibleLength(t *testing.T) {
+	tests := []struct {
+		source string
+		want   int
+	}{
+		{"hello", 5},
+		{"**bold** _em_", 7},
+		// the link target doesn't count
+		{"[site](https://example.com/a/very/long/path)", 4},
+		{"see https://example.com now", 27},
+		{"- a\n- b", 3},
+		{"a &amp; b", 5},
+		{"héllo wörld", 11},
+		// a block of raw html isn't rendered at all
+		{"<script>alert(1)</script>", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := VisibleLength(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("VisibleLength(%q) = %d, want %d", tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostViews is a number of impressions of a post on a given (UTC) day.
+type PostViews struct {
+	PostID int64
+	Day    time.Time
+	Views  int
+}
+
+type AnalyticsCounts struct {
+	Views    int `json:"views"`
+	Comments int `json:"comments"`
+	Reposts  int `json:"reposts"`
+	Quotes   int `json:"quotes"`
+}
+
+type DailyStats struct {
+	Day string `json:"day"`
+	AnalyticsCounts
+}
+
+type PostAnalytics struct {
+	PostID int64           `json:"post_id"`
+	Title  string          `json:"title"`
+	Totals AnalyticsCounts `json:"totals"`
+	Days   []DailyStats    `json:"days"`
+}
+
+type AnalyticsStore struct {
+	db *sql.DB
+}
+
+// AddViews adds a batch of impressions to the daily counters. Views of
+// posts deleted in the meantime are dropped.
+func (s *AnalyticsStore) AddViews(ctx context.Context, views []PostViews) error {
+	if len(views) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	postIDs := make([]int64, len(views))
+	days := make([]string, len(views))
+	counts := make([]int64, len(views))
+	for i, v := range views {
+		postIDs[i] = v.PostID
+		days[i] = v.Day.Format(time.DateOnly)
+		counts[i] = int64(v.Views)
+	}
+
+	query := `
+	INSERT INTO post_views_daily (post_id, day, views)
+	SELECT v.post_id, v.day, v.views
+	FROM unnest($1::bigint[], $2::date[], $3::int[]) AS v (post_id, day, views)
+	JOIN posts p ON p.id = v.post_id
+	ON CONFLICT (post_id, day) DO UPDATE SET views = post_views_daily.views + EXCLUDED.views
+	`
+	_, err := s.db.ExecContext(ctx, query, pq.Array(postIDs), pq.Array(days), pq.Array(counts))
+	return err
+}
+
+// GetForAuthor returns daily views, comments, reposts and quotes of the
+// user's posts between from and to, both inclusive. Posts without any
+// activity in the range are left out.
+func (s *AnalyticsStore) GetForAuthor(ctx context.Context, userID int64, from, to time.Time) ([]PostAnalytics, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	WITH own AS (
+		SELECT id, title FROM posts WHERE user_id = $1
+	),
+	events AS (
+		SELECT v.post_id, v.day, v.views, 0 AS comments, 0 AS reposts, 0 AS quotes
+		FROM post_views_daily v
+		JOIN own ON own.id = v.post_id
+		WHERE v.day BETWEEN $2 AND $3
+		UNION ALL
+		SELECT c.post_id, (c.created_at AT TIME ZONE 'UTC')::date, 0, 1, 0, 0
+		FROM comments c
+		JOIN own ON own.id = c.post_id
+		WHERE c.hidden_at IS NULL AND (c.created_at AT TIME ZONE 'UTC')::date BETWEEN $2 AND $3
+		UNION ALL
+		SELECT r.post_id, (r.created_at AT TIME ZONE 'UTC')::date, 0, 0, 1, 0
+		FROM reposts r
+		JOIN own ON own.id = r.post_id
+		WHERE (r.created_at AT TIME ZONE 'UTC')::date BETWEEN $2 AND $3
+		UNION ALL
+		SELECT q.quote_of_id, (q.created_at AT TIME ZONE 'UTC')::date, 0, 0, 0, 1
+		FROM posts q
+		JOIN own ON own.id = q.quote_of_id
+		WHERE (q.created_at AT TIME ZONE 'UTC')::date BETWEEN $2 AND $3
+	)
+	SELECT e.post_id, own.title, to_char(e.day, 'YYYY-MM-DD'),
+		SUM(e.views), SUM(e.comments), SUM(e.reposts), SUM(e.quotes)
+	FROM events e
+	JOIN own ON own.id = e.post_id
+	GROUP BY e.post_id, own.title, e.day
+	ORDER BY e.post_id DESC, e.day
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []PostAnalytics{}
+	for rows.Next() {
+		var (
+			postID int64
+			title  string
+			d      DailyStats
+		)
+		if err := rows.Scan(&postID, &title, &d.Day, &d.Views, &d.Comments, &d.Reposts, &d.Quotes); err != nil {
+			return nil, err
+		}
+		if len(stats) == 0 || stats[len(stats)-1].PostID != postID {
+			stats = append(stats, PostAnalytics{PostID: postID, Title: title})
+		}
+		p := &stats[len(stats)-1]
+		p.Days = append(p.Days, d)
+		p.Totals.Views += d.Views
+		p.Totals.Comments += d.Comments
+		p.Totals.Reposts += d.Reposts
+		p.Totals.Quotes += d.Quotes
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrBlocked = errors.New("you can't interact with this user")
+
+// RelatedUser is an entry in the list of users someone blocked or muted.
+type RelatedUser struct {
+	User  User      `json:"user"`
+	Since time.Time `json:"since"`
+}
+
+// blockedBetween returns a SQL condition that holds when either of the two
+// user ids blocked the other.
+func blockedBetween(a, b string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM blocks vbk
+		WHERE (vbk.blocker_id = %[1]s AND vbk.blocked_id = %[2]s) OR (vbk.blocker_id = %[2]s AND vbk.blocked_id = %[1]s)
+	)`, a, b)
+}
+
+// mutedBy returns a SQL condition that holds when muter muted the user id
+// in muted.
+func mutedBy(muter, muted string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM mutes vmu WHERE vmu.muter_id = %s AND vmu.muted_id = %s)`, muter, muted)
+}
+
+// BlockStore keeps blocks and mutes. A block works both ways: neither user
+// sees the other's content and follows between them are removed. A mute only
+// keeps the muted user out of the muter's feed, comments and mentions.
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block makes blockerID block blockedID and drops the follows and follow
+// requests between them.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2)`, blockerID, blockedID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		query := `
+		DELETE FROM followers
+		WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+		query = `
+		DELETE FROM follow_requests
+		WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+		_, err = tx.ExecContext(ctx, query, blockerID, blockedID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return s.delete(ctx, `DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2`, blockerID, blockedID)
+}
+
+func (s *BlockStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO mutes (muter_id, muted_id) VALUES ($1, $2)`, muterID, mutedID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return s.delete(ctx, `DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2`, muterID, mutedID)
+}
+
+func (s *BlockStore) delete(ctx context.Context, query string, userID, otherID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, otherID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsBlocked reports whether blockerID blocked blockedID.
+func (s *BlockStore) IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT EXISTS (SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, blockerID, blockedID).Scan(&blocked)
+	return blocked, err
+}
+
+// GetBlocked lists the users userID blocked, most recent first by default.
+func (s *BlockStore) GetBlocked(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]RelatedUser, Cursors, error) {
+	return s.list(ctx, "blocks", "blocker_id", "blocked_id", userID, fq)
+}
+
+// GetMuted lists the users userID muted, most recent first by default.
+func (s *BlockStore) GetMuted(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]RelatedUser, Cursors, error) {
+	return s.list(ctx, "mutes", "muter_id", "muted_id", userID, fq)
+}
+
+func (s *BlockStore) list(ctx context.Context, table, column, other string, userID int64, fq PaginatedFeedQuery) ([]RelatedUser, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+
+	query := `
+	SELECT u.id, u.username, u.display_name, u.bio, COALESCE(am.url, ''), r.created_at
+	FROM ` + table + ` r
+	JOIN users u ON u.id = r.` + other + `
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE r.` + column + ` = $1
+	AND ($2::timestamptz IS NULL OR (r.created_at, r.` + other + `) ` + k.Compare + ` ($2, $3))
+	ORDER BY r.created_at ` + k.Order + `, r.` + other + ` ` + k.Order + `
+	LIMIT $4
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, afterTime, afterID, fq.Limit+1)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
+
+	users := []RelatedUser{}
+	for rows.Next() {
+		var ru RelatedUser
+		err := rows.Scan(&ru.User.ID, &ru.User.Username, &ru.User.DisplayName, &ru.User.Bio, &ru.User.AvatarURL, &ru.Since)
+		if err != nil {
+			return nil, Cursors{}, err
+		}
+		users = append(users, ru)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
+	}
+
+	users, cursors := pageCursors(users, fq.Limit, k, k.After != nil, func(e RelatedUser) cursor {
+		return cursor{CreatedAt: e.Since, ID: e.User.ID}
+	})
+	return users, cursors, nil
+}
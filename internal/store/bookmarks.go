@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidCollection = errors.New("bookmark collection not found")
+
+type Bookmark struct {
+	Post         PostWithMetadata `json:"post"`
+	CollectionID *int64           `json:"collection_id"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+type BookmarkCollection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+// Bookmark saves a post for the user, or moves an existing bookmark to
+// collectionID. A nil collectionID leaves it outside any collection.
+func (s *BookmarkStore) Bookmark(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if collectionID != nil {
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $1 AND user_id = $2)`
+		if err := s.db.QueryRowContext(ctx, query, *collectionID, userID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrInvalidCollection
+		}
+	}
+
+	query := `
+	INSERT INTO bookmarks (user_id, post_id, collection_id) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+	`
+	_, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *BookmarkStore) Unbookmark(ctx context.Context, userID, postID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetForUser lists the user's bookmarks newest first (or oldest first when
+// sorting asc), starting from fq.Cursor. It returns the cursors of the pages
+// around it. Search and tags filter on the post, since and until on when it
+// was bookmarked.
+func (s *BookmarkStore) GetForUser(ctx context.Context, userID int64, collectionID *int64, fq PaginatedFeedQuery) ([]Bookmark, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+
+	query := `
+	SELECT
+		p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags,
+		p.quote_of_id, p.is_quote, p.visibility, u.id, u.username, b.collection_id, b.created_at,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count,
+		(SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count,
+		(SELECT COUNT(*) FROM posts q WHERE q.quote_of_id = p.id) AS quotes_count
+	FROM bookmarks b
+	JOIN posts p ON p.id = b.post_id
+	LEFT JOIN users u ON u.id = p.user_id
+	WHERE b.user_id = $1
+	AND ($2::bigint IS NULL OR b.collection_id = $2)
+	AND (p.title ILIKE '%' || $3 || '%' OR p.content ILIKE '%' || $3 || '%')
+	AND (p.tags @> $4 OR $4 = '{}')
+	AND ($8 = '' OR b.created_at >= NULLIF($8, '')::timestamptz)
+	AND ($9 = '' OR b.created_at <= NULLIF($9, '')::timestamptz)
+	AND ` + postVisibleTo("p", "$1") + `
+	AND ($5::timestamptz IS NULL OR (b.created_at, b.post_id) ` + k.Compare + ` ($5, $6))
+	ORDER BY b.created_at ` + k.Order + `, b.post_id ` + k.Order + `
+	LIMIT $7
+	`
+	// fetch one extra row to know whether there is a next page
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		collectionID,
+		fq.Search,
+		pq.Array(fq.Tags),
+		afterTime,
+		afterID,
+		fq.Limit+1,
+		fq.Since,
+		fq.Until,
+	)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		p := &b.Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.ContentHTML,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.QuoteOfID,
+			&p.IsQuote,
+			&p.Visibility,
+			&p.User.ID,
+			&p.User.Username,
+			&b.CollectionID,
+			&b.CreatedAt,
+			&p.CommentCount,
+			&p.RepostCount,
+			&p.QuoteCount,
+		)
+		if err != nil {
+			return nil, Cursors{}, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
+	}
+
+	bookmarks, cursors := pageCursors(bookmarks, fq.Limit, k, k.After != nil, func(b Bookmark) cursor {
+		return cursor{CreatedAt: b.CreatedAt, ID: b.Post.ID}
+	})
+
+	ptrs := make([]*Post, len(bookmarks))
+	for i := range bookmarks {
+		ptrs[i] = &bookmarks[i].Post.Post
+	}
+	if err := loadPostRelations(ctx, s.db, ptrs, &userID); err != nil {
+		return nil, Cursors{}, err
+	}
+	return bookmarks, cursors, nil
+}
+
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at
+	`
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *BookmarkStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id, user_id, name, created_at FROM bookmark_collections WHERE user_id = $1 ORDER BY name
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// DeleteCollection removes a collection. Its bookmarks are kept outside of
+// any collection.
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userID, collectionID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -6,19 +6,26 @@ import (
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostId    int64  `json:"post_id"`
-	UserId    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID        int64     `json:"id"`
+	PostId    int64     `json:"post_id"`
+	UserId    int64     `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt string    `json:"created_at"`
+	User      User      `json:"user"`
+	Mentions  []Mention `json:"mentions"`
+	// HeldForReview is set on create when a content filter held the
+	// comment back for moderation, HoldReason says why
+	HeldForReview bool   `json:"held_for_review,omitempty"`
+	HoldReason    string `json:"-"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByPostId lists the comments on a post, leaving out those by users the
+// viewer blocked, muted or was blocked by.
+func (s *CommentStore) GetByPostId(ctx context.Context, postID, viewerID int64) ([]Comment, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	query := `
@@ -34,9 +41,11 @@ func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment
 	JOIN users
 	ON 
 	users.id = c.user_id
-	WHERE c.post_id = $1
+	WHERE c.post_id = $1 AND c.hidden_at IS NULL
+	AND NOT ` + blockedBetween("c.user_id", "$2") + `
+	AND NOT ` + mutedBy("$2", "c.user_id") + `
 	ORDER BY c.created_at DESC;`
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -53,32 +62,53 @@ func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment
 		comments = append(comments, c)
 	}
 
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	mentions, err := getMentionsByCommentIDs(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Mentions = mentions[comments[i].ID]
+	}
+
 	return comments, nil
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	query := `
-	INSERT INTO comments (post_id, user_id, content)
-	VALUES($1,$2, $3)
+	INSERT INTO comments (post_id, user_id, content, hidden_at)
+	VALUES($1,$2, $3, CASE WHEN $4 THEN NOW() END)
 	RETURNING id, created_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.PostId,
-		comment.UserId,
-		comment.Content,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
-	)
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostId,
+			comment.UserId,
+			comment.Content,
+			comment.HeldForReview,
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		if comment.HeldForReview {
+			if err := holdForReview(ctx, tx, ReportTargetComment, comment.ID, comment.HoldReason); err != nil {
+				return err
+			}
+		}
 
-	return nil
+		comment.Mentions, err = saveMentions(ctx, tx, comment.PostId, &comment.ID, comment.UserId, comment.Content)
+		return err
+	})
 }
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	FilterActionReject = "reject"
+	FilterActionHold   = "hold"
+)
+
+// FilterRule configures one filter of the content filter chain. Config is
+// specific to the filter named by Name.
+type FilterRule struct {
+	Name     string          `json:"name"`
+	Position int             `json:"position"`
+	Action   string          `json:"action"`
+	Config   json.RawMessage `json:"config"`
+}
+
+type ContentFilterStore struct {
+	db *sql.DB
+}
+
+// GetRules returns the enabled filter rules in the order they run.
+func (s *ContentFilterStore) GetRules(ctx context.Context) ([]FilterRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT name, position, action, config FROM content_filters WHERE enabled ORDER BY position, name
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []FilterRule{}
+	for rows.Next() {
+		var r FilterRule
+		if err := rows.Scan(&r.Name, &r.Position, &r.Action, &r.Config); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// CountRecent counts the posts or comments, depending on kind, that the
+// user wrote since the given time.
+func (s *ContentFilterStore) CountRecent(ctx context.Context, userID int64, kind string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `SELECT COUNT(*) FROM ` + contentTable(kind) + ` WHERE user_id = $1 AND created_at > $2`
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID, since).Scan(&count)
+	return count, err
+}
+
+// HasDuplicate reports whether the user wrote the same post or comment
+// since the given time, ignoring case and surrounding whitespace.
+func (s *ContentFilterStore) HasDuplicate(ctx context.Context, userID int64, kind, content string, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM ` + contentTable(kind) + `
+		WHERE user_id = $1 AND created_at > $2 AND lower(btrim(content)) = lower(btrim($3))
+	)`
+
+	var found bool
+	err := s.db.QueryRowContext(ctx, query, userID, since, content).Scan(&found)
+	return found, err
+}
+
+func contentTable(kind string) string {
+	if kind == ReportTargetComment {
+		return "comments"
+	}
+	return "posts"
+}
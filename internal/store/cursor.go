@@ -0,0 +1,139 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorKey signs cursors so clients can't make up positions. It is set once
+// at startup by SetCursorKey.
+var cursorKey []byte
+
+func SetCursorKey(key []byte) {
+	cursorKey = key
+}
+
+// cursor marks a position in a list ordered by (created_at, id). Clients get
+// it as an opaque, signed string.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+	// Before pages backwards, to the entries preceding the position
+	Before bool `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(signCursor(b))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signCursor(b)) {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func signCursor(b []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// keyset is where a cursor paginated read starts. A nil After reads from
+// the start of the list.
+type keyset struct {
+	After *cursor
+	// Compare and Order are the operator to compare (created_at, id) with
+	// the cursor and the direction to read in
+	Compare string
+	Order   string
+}
+
+// newKeyset decodes the cursor of fq for a list sorted by fq.Sort. Paging
+// backwards reads the list in reverse, pageCursors puts it back in order.
+func newKeyset(fq PaginatedFeedQuery) (keyset, error) {
+	k := keyset{Compare: "<", Order: "desc"}
+	if fq.Sort == "asc" {
+		k = keyset{Compare: ">", Order: "asc"}
+	}
+	if fq.Cursor == "" {
+		return k, nil
+	}
+
+	c, err := decodeCursor(fq.Cursor)
+	if err != nil {
+		return k, err
+	}
+	k.After = &c
+	if c.Before {
+		k.Compare = map[string]string{"<": ">", ">": "<"}[k.Compare]
+		k.Order = map[string]string{"desc": "asc", "asc": "desc"}[k.Order]
+	}
+	return k, nil
+}
+
+// Args returns the cursor position as query arguments, both nil without a
+// cursor.
+func (k keyset) Args() (*time.Time, *int64) {
+	if k.After == nil {
+		return nil, nil
+	}
+	return &k.After.CreatedAt, &k.After.ID
+}
+
+// Cursors lead to the pages after and before a page, they are left empty at
+// either end of the list.
+type Cursors struct {
+	Next string `json:"next_cursor,omitempty"`
+	Prev string `json:"prev_cursor,omitempty"`
+}
+
+// pageCursors trims entries, read with a limit of limit+1, to the page and
+// returns the cursors of the pages after and before it. hasPrevious says
+// whether the page was reached by skipping entries, with a cursor or an
+// offset.
+func pageCursors[T any](entries []T, limit int, k keyset, hasPrevious bool, position func(T) cursor) ([]T, Cursors) {
+	more := len(entries) > limit
+	if more {
+		entries = entries[:limit]
+	}
+	backwards := k.After != nil && k.After.Before
+	if backwards {
+		slices.Reverse(entries)
+	}
+	var c Cursors
+	if len(entries) == 0 {
+		return entries, c
+	}
+	if more || backwards {
+		c.Next = encodeCursor(position(entries[len(entries)-1]))
+	}
+	if (backwards && more) || (!backwards && hasPrevious) {
+		first := position(entries[0])
+		first.Before = true
+		c.Prev = encodeCursor(first)
+	}
+	return entries, c
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// testCelebrityFollowers is high enough that every test account is fanned
+// out to its followers.
+const testCelebrityFollowers = 1000
+
+func feedQuery() PaginatedFeedQuery {
+	return PaginatedFeedQuery{Limit: 20, MaxLimit: 100, Sort: "desc"}
+}
+
+// feedIDs reads the first page of the home feed of userID and returns the
+// ids of the posts on it in order.
+func feedIDs(t *testing.T, s Storage, userID int64) []int64 {
+	t.Helper()
+	feed, _, err := s.Timelines.GetFeed(context.Background(), userID, feedQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int64, len(feed))
+	for i, p := range feed {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func assertFeed(t *testing.T, s Storage, userID int64, want ...int64) {
+	t.Helper()
+	if want == nil {
+		want = []int64{}
+	}
+	if got := feedIDs(t, s, userID); !slices.Equal(got, want) {
+		t.Errorf("feed of user %d is %v, want %v", userID, got, want)
+	}
+}
+
+func TestFeedHasOwnPostsWithoutFollows(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	assertFeed(t, s, alice.ID)
+
+	first := createTestPost(t, s, alice.ID, "first")
+	second := createTestPost(t, s, alice.ID, "second")
+	assertFeed(t, s, alice.ID, second.ID, first.ID)
+}
+
+func TestFeedHasOwnPostsOnce(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, alice.ID, bob.ID)
+	follow(t, s, alice.ID, carol.ID)
+	// a follower of alice mustn't put her posts in her own feed twice
+	follow(t, s, bob.ID, alice.ID)
+
+	post := createTestPost(t, s, alice.ID, "hello")
+	if err := s.Timelines.FanOut(context.Background(), FanoutJob{PostID: post.ID}, testCelebrityFollowers); err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, s, alice.ID, post.ID)
+	assertFeed(t, s, bob.ID, post.ID)
+}
+
+func TestFeedFollow(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+
+	before := createTestPost(t, s, bob.ID, "before the follow")
+	createTestPost(t, s, carol.ID, "not followed")
+	assertFeed(t, s, alice.ID)
+
+	// following brings in what bob already posted
+	follow(t, s, alice.ID, bob.ID)
+	assertFeed(t, s, alice.ID, before.ID)
+
+	// and new posts once they are fanned out
+	after := createTestPost(t, s, bob.ID, "after the follow")
+	if err := s.Timelines.FanOut(ctx, FanoutJob{PostID: after.ID}, testCelebrityFollowers); err != nil {
+		t.Fatal(err)
+	}
+	own := createTestPost(t, s, alice.ID, "own")
+	assertFeed(t, s, alice.ID, own.ID, after.ID, before.ID)
+}
+
+func TestFeedUnfollow(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, alice.ID, bob.ID)
+	follow(t, s, alice.ID, carol.ID)
+
+	bobs := createTestPost(t, s, bob.ID, "bob")
+	carols := createTestPost(t, s, carol.ID, "carol")
+	for _, id := range []int64{bobs.ID, carols.ID} {
+		if err := s.Timelines.FanOut(ctx, FanoutJob{PostID: id}, testCelebrityFollowers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	own := createTestPost(t, s, alice.ID, "own")
+	assertFeed(t, s, alice.ID, own.ID, carols.ID, bobs.ID)
+
+	unfollow(t, s, alice.ID, bob.ID)
+	assertFeed(t, s, alice.ID, own.ID, carols.ID)
+
+	// following again brings bob's posts back
+	follow(t, s, alice.ID, bob.ID)
+	assertFeed(t, s, alice.ID, own.ID, carols.ID, bobs.ID)
+}
+
+func TestFeedPaging(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	var want []int64
+	for range 5 {
+		want = append([]int64{createTestPost(t, s, alice.ID, "post").ID}, want...)
+	}
+
+	fq := feedQuery()
+	fq.Limit = 2
+	var got []int64
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatal("the feed never ran out of pages")
+		}
+		feed, cursors, err := s.Timelines.GetFeed(ctx, alice.ID, fq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range feed {
+			got = append(got, p.ID)
+		}
+		if cursors.Next == "" {
+			break
+		}
+		fq.Cursor = cursors.Next
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
+
+func TestFeedHidesBlockedAccounts(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	dave := createTestUser(t, db, s, "dave")
+
+	carols := createTestPost(t, s, carol.ID, "carol")
+	bobs := createTestPost(t, s, bob.ID, "bob")
+	daves := createTestPost(t, s, dave.ID, "dave")
+	// alice only sees bob and dave through carol's reposts
+	for _, id := range []int64{bobs.ID, daves.ID} {
+		if err := s.Reposts.Repost(ctx, carol.ID, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	follow(t, s, alice.ID, carol.ID)
+	assertFeed(t, s, alice.ID, daves.ID, bobs.ID, carols.ID)
+
+	// blocks hide posts both ways
+	if err := s.Blocks.Block(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Blocks.Block(ctx, dave.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, s, alice.ID, carols.ID)
+}
+
+func TestFeedHidesMutedAccounts(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	dave := createTestUser(t, db, s, "dave")
+
+	bobs := createTestPost(t, s, bob.ID, "bob")
+	carols := createTestPost(t, s, carol.ID, "carol")
+	daves := createTestPost(t, s, dave.ID, "dave")
+	if err := s.Reposts.Repost(ctx, carol.ID, daves.ID); err != nil {
+		t.Fatal(err)
+	}
+	follow(t, s, alice.ID, bob.ID)
+	follow(t, s, alice.ID, carol.ID)
+	assertFeed(t, s, alice.ID, daves.ID, carols.ID, bobs.ID)
+
+	if err := s.Blocks.Mute(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, s, alice.ID, daves.ID, carols.ID)
+
+	// muting carol takes her reposts out too
+	if err := s.Blocks.Mute(ctx, alice.ID, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, s, alice.ID)
+}
+
+func TestFeedAppliesVisibility(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	createTestUser(t, db, s, "carol")
+
+	post := func(visibility, content string) int64 {
+		t.Helper()
+		p := &Post{UserID: bob.ID, Title: visibility, Content: content, Visibility: visibility}
+		if err := s.Posts.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		return p.ID
+	}
+	public := post(VisibilityPublic, "for everyone")
+	followers := post(VisibilityFollowers, "for followers")
+	mentioned := post(VisibilityMentioned, "for @alice")
+	post(VisibilityMentioned, "for @carol")
+	post(VisibilityPrivate, "for bob")
+
+	follow(t, s, alice.ID, bob.ID)
+	assertFeed(t, s, alice.ID, mentioned, followers, public)
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -13,40 +15,296 @@ type Follower struct {
 	CreatedAt  int64 `json:"created_at"`
 }
 
+// FollowListEntry is a user in a followers or following list. The flags
+// describe the user's relationship to the one reading the list.
+type FollowListEntry struct {
+	User       User      `json:"user"`
+	FollowedAt time.Time `json:"followed_at"`
+	FollowsYou bool      `json:"follows_you"`
+	YouFollow  bool      `json:"you_follow"`
+}
+
+// FollowRequest is a pending request to follow a private account.
+type FollowRequest struct {
+	User        User      `json:"user"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
 type FollowerStore struct {
 	*sql.DB
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+// Follow makes followerID follow userID. Private accounts approve their
+// followers, so following one only files a request and requested is true.
+// Users can't follow each other while either has blocked the other.
+func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) (requested bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err = withTx(s.DB, ctx, func(tx *sql.Tx) error {
+		var private bool
+		err := tx.QueryRowContext(ctx, `SELECT is_private FROM users WHERE id = $1`, userID).Scan(&private)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		var blocked bool
+		err = tx.QueryRowContext(ctx, `SELECT `+blockedBetween("$1::bigint", "$2::bigint"), userID, followerID).Scan(&blocked)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `
+		INSERT INTO followers (user_id, follower_id) VALUES($1, $2)
+		`
+		if private && followerID != userID {
+			var following bool
+			err := tx.QueryRowContext(
+				ctx,
+				`SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`,
+				userID,
+				followerID,
+			).Scan(&following)
+			if err != nil {
+				return err
+			}
+			if following {
+				return ErrConflict
+			}
+			requested = true
+			query = `
+			INSERT INTO follow_requests (user_id, requester_id) VALUES($1, $2)
+			`
+		}
+		_, err = tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return requested, nil
+}
+
+// Unfollow stops followerID following userID, or withdraws a pending
+// follow request.
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
 	query := `
-	INSERT INTO followers (user_id, follower_id) VALUES($1, $2)
+	WITH unfollowed AS (
+		DELETE FROM followers WHERE user_id = $1 AND follower_id = $2 RETURNING 1
+	), withdrawn AS (
+		DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2 RETURNING 1
+	)
+	SELECT (SELECT COUNT(*) FROM unfollowed) + (SELECT COUNT(*) FROM withdrawn)
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	_, err := s.DB.ExecContext(ctx, query, userID, followerID)
+	var rows int
+	if err := s.DB.QueryRowContext(ctx, query, userID, followerID).Scan(&rows); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsFollowing reports whether followerID follows userID.
+func (s *FollowerStore) IsFollowing(ctx context.Context, followerID, userID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var following bool
+	err := s.DB.QueryRowContext(ctx, query, userID, followerID).Scan(&following)
+	return following, err
+}
+
+// GetFollowers lists the users following userID, most recent first by
+// default.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, fq PaginatedFeedQuery) ([]FollowListEntry, Cursors, error) {
+	return s.getFollowList(ctx, "user_id", "follower_id", userID, viewerID, fq)
+}
+
+// GetFollowing lists the users userID follows, most recent first by default.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, fq PaginatedFeedQuery) ([]FollowListEntry, Cursors, error) {
+	return s.getFollowList(ctx, "follower_id", "user_id", userID, viewerID, fq)
+}
+
+// getFollowList pages through the followers rows where column is userID and
+// returns the users in other, keyed on (created_at, other).
+func (s *FollowerStore) getFollowList(ctx context.Context, column, other string, userID, viewerID int64, fq PaginatedFeedQuery) ([]FollowListEntry, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrConflict
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+
+	query := `
+	SELECT u.id, u.username, u.display_name, u.bio, COALESCE(am.url, ''), u.followers_count, u.following_count,
+		f.created_at,
+		EXISTS (SELECT 1 FROM followers x WHERE x.user_id = $2 AND x.follower_id = u.id) AS follows_you,
+		EXISTS (SELECT 1 FROM followers x WHERE x.user_id = u.id AND x.follower_id = $2) AS you_follow
+	FROM followers f
+	JOIN users u ON u.id = f.` + other + `
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE f.` + column + ` = $1
+	AND ($3::timestamptz IS NULL OR (f.created_at, f.` + other + `) ` + k.Compare + ` ($3, $4))
+	ORDER BY f.created_at ` + k.Order + `, f.` + other + ` ` + k.Order + `
+	LIMIT $5
+	`
+	// fetch one extra row to know whether there is a next page
+	rows, err := s.DB.QueryContext(ctx, query, userID, viewerID, afterTime, afterID, fq.Limit+1)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
+
+	entries := []FollowListEntry{}
+	for rows.Next() {
+		var e FollowListEntry
+		err := rows.Scan(
+			&e.User.ID,
+			&e.User.Username,
+			&e.User.DisplayName,
+			&e.User.Bio,
+			&e.User.AvatarURL,
+			&e.User.FollowersCount,
+			&e.User.FollowingCount,
+			&e.FollowedAt,
+			&e.FollowsYou,
+			&e.YouFollow,
+		)
+		if err != nil {
+			return nil, Cursors{}, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
+	}
+
+	entries, cursors := pageCursors(entries, fq.Limit, k, k.After != nil, func(e FollowListEntry) cursor {
+		return cursor{CreatedAt: e.FollowedAt, ID: e.User.ID}
+	})
+	return entries, cursors, nil
+}
+
+// GetFollowRequests lists the pending requests to follow userID, newest
+// first by default.
+func (s *FollowerStore) GetFollowRequests(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FollowRequest, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+
+	query := `
+	SELECT u.id, u.username, u.display_name, u.bio, COALESCE(am.url, ''), u.followers_count, u.following_count,
+		fr.created_at
+	FROM follow_requests fr
+	JOIN users u ON u.id = fr.requester_id
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE fr.user_id = $1
+	AND ($2::timestamptz IS NULL OR (fr.created_at, fr.requester_id) ` + k.Compare + ` ($2, $3))
+	ORDER BY fr.created_at ` + k.Order + `, fr.requester_id ` + k.Order + `
+	LIMIT $4
+	`
+	rows, err := s.DB.QueryContext(ctx, query, userID, afterTime, afterID, fq.Limit+1)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		err := rows.Scan(
+			&fr.User.ID,
+			&fr.User.Username,
+			&fr.User.DisplayName,
+			&fr.User.Bio,
+			&fr.User.AvatarURL,
+			&fr.User.FollowersCount,
+			&fr.User.FollowingCount,
+			&fr.RequestedAt,
+		)
+		if err != nil {
+			return nil, Cursors{}, err
 		}
+		requests = append(requests, fr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
+	}
+
+	requests, cursors := pageCursors(requests, fq.Limit, k, k.After != nil, func(e FollowRequest) cursor {
+		return cursor{CreatedAt: e.RequestedAt, ID: e.User.ID}
+	})
+	return requests, cursors, nil
+}
+
+// AcceptFollowRequest turns requesterID's pending request into a follow of
+// userID.
+func (s *FollowerStore) AcceptFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	query := `
+	WITH accepted AS (
+		DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
+		RETURNING user_id, requester_id
+	), followed AS (
+		INSERT INTO followers (user_id, follower_id)
+		SELECT user_id, requester_id FROM accepted
+		ON CONFLICT DO NOTHING
+	)
+	SELECT COUNT(*) FROM accepted
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var accepted int
+	if err := s.DB.QueryRowContext(ctx, query, userID, requesterID).Scan(&accepted); err != nil {
 		return err
 	}
+	if accepted == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
-func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+
+// RejectFollowRequest drops requesterID's pending request to follow userID.
+func (s *FollowerStore) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
 	query := `
-	DELETE FROM followers 
-	WHERE user_id=$1
-	AND follower_id=$2
+	DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	resp, err := s.DB.ExecContext(ctx, query, userID, followerID)
+	res, err := s.DB.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-	rows, err := resp.RowsAffected()
 	if rows == 0 {
 		return ErrNotFound
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/temideewan/go-social/internal/entities"
+)
+
+const (
+	MaxPostTags  = 10
+	MaxTagLength = 100
+)
+
+var ErrTooManyTags = fmt.Errorf("a post can have at most %d tags, including hashtags", MaxPostTags)
+
+// Hashtag is a #tag found in a post. Start and End are character offsets
+// into the field it was found in, either "title" or "content".
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+func extractHashtags(title, content string) []Hashtag {
+	hashtags := []Hashtag{}
+	for _, field := range []struct{ name, text string }{{"title", title}, {"content", content}} {
+		for _, e := range entities.Hashtags(field.text) {
+			hashtags = append(hashtags, Hashtag{
+				Tag:   normalizeTag(e.Text),
+				Field: field.name,
+				Start: e.Start,
+				End:   e.End,
+			})
+		}
+	}
+	return hashtags
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+}
+
+// mergeTags normalizes the explicit tags of a post and appends the hashtags
+// found in its text, dropping duplicates.
+func mergeTags(explicit []string, hashtags []Hashtag) []string {
+	seen := make(map[string]bool)
+	tags := []string{}
+	add := func(tag string) {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] || len([]rune(tag)) > MaxTagLength {
+			return
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	for _, tag := range explicit {
+		add(tag)
+	}
+	for _, h := range hashtags {
+		add(h.Tag)
+	}
+	return tags
+}
+
+// resolveTags sets the tags and hashtag entities of post from its explicit
+// tags and text.
+func resolveTags(post *Post) error {
+	post.Hashtags = extractHashtags(post.Title, post.Content)
+	post.Tags = mergeTags(post.ExplicitTags, post.Hashtags)
+	if len(post.Tags) > MaxPostTags {
+		return ErrTooManyTags
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/temideewan/go-social/internal/entities"
+)
+
+// LinkPreview is the card shown for the first url in a post. Previews are
+// cached by url and shared between posts.
+type LinkPreview struct {
+	ID          int64     `json:"-"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"`
+	SiteName    string    `json:"site_name"`
+	Failed      bool      `json:"-"`
+	FetchedAt   time.Time `json:"-"`
+}
+
+type LinkPreviewStore struct {
+	db *sql.DB
+}
+
+// hasURL reports whether content gets a link preview. Posts that do are
+// marked pending until the unfurler is done with them.
+func hasURL(content string) bool {
+	return len(entities.URLs(content)) > 0
+}
+
+func (s *LinkPreviewStore) GetByURL(ctx context.Context, url string) (*LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id, url, title, description, image_url, site_name, failed, fetched_at
+	FROM link_previews WHERE url = $1
+	`
+	var p LinkPreview
+	err := s.db.QueryRowContext(ctx, query, url).Scan(
+		&p.ID,
+		&p.URL,
+		&p.Title,
+		&p.Description,
+		&p.ImageURL,
+		&p.SiteName,
+		&p.Failed,
+		&p.FetchedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// Save stores a freshly fetched preview, replacing the cached one for the
+// same url.
+func (s *LinkPreviewStore) Save(ctx context.Context, preview *LinkPreview) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	INSERT INTO link_previews (url, title, description, image_url, site_name, failed, fetched_at)
+	VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	ON CONFLICT (url) DO UPDATE SET
+		title = EXCLUDED.title,
+		description = EXCLUDED.description,
+		image_url = EXCLUDED.image_url,
+		site_name = EXCLUDED.site_name,
+		failed = EXCLUDED.failed,
+		fetched_at = EXCLUDED.fetched_at
+	RETURNING id, fetched_at
+	`
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		preview.URL,
+		preview.Title,
+		preview.Description,
+		preview.ImageURL,
+		preview.SiteName,
+		preview.Failed,
+	).Scan(&preview.ID, &preview.FetchedAt)
+}
+
+// SetForPost attaches a preview to a post, a nil previewID removes it.
+// Either way the post is no longer pending.
+func (s *LinkPreviewStore) SetForPost(ctx context.Context, postID int64, previewID *int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	UPDATE posts SET link_preview_id = $2, link_preview_pending = FALSE WHERE id = $1
+	`
+	res, err := s.db.ExecContext(ctx, query, postID, previewID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetPending returns the ids of the posts still waiting for their preview,
+// oldest first.
+func (s *LinkPreviewStore) GetPending(ctx context.Context) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id FROM posts WHERE link_preview_pending ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func getLinkPreviewsByPostIDs(ctx context.Context, db *sql.DB, postIDs []int64) (map[int64]*LinkPreview, error) {
+	previews := make(map[int64]*LinkPreview)
+	if len(postIDs) == 0 {
+		return previews, nil
+	}
+
+	query := `
+	SELECT p.id, lp.id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name, lp.fetched_at
+	FROM posts p
+	JOIN link_previews lp ON lp.id = p.link_preview_id
+	WHERE p.id = ANY($1) AND NOT lp.failed
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID int64
+			lp     LinkPreview
+		)
+		err := rows.Scan(&postID, &lp.ID, &lp.URL, &lp.Title, &lp.Description, &lp.ImageURL, &lp.SiteName, &lp.FetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		previews[postID] = &lp
+	}
+	return previews, rows.Err()
+}
@@ -0,0 +1,330 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidMedia  = errors.New("media not found or not owned by user")
+	ErrMediaNotReady = errors.New("media is still processing or failed to process")
+)
+
+const (
+	MediaStatusPending    = "pending"
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+type Media struct {
+	ID         int64  `json:"id"`
+	UserID     int64  `json:"user_id"`
+	StorageKey string `json:"-"`
+	// URL is empty until the media is ready
+	URL             string      `json:"url"`
+	MimeType        string      `json:"mime_type"`
+	Size            int64       `json:"size"`
+	Status          string      `json:"status"`
+	Width           int         `json:"width"`
+	Height          int         `json:"height"`
+	Blurhash        string      `json:"blurhash"`
+	ProcessingError string      `json:"processing_error,omitempty"`
+	Thumbnails      []Thumbnail `json:"thumbnails"`
+	CreatedAt       string      `json:"created_at"`
+}
+
+type Thumbnail struct {
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	StorageKey string `json:"-"`
+	URL        string `json:"url"`
+	MimeType   string `json:"mime_type"`
+}
+
+type Attachment struct {
+	MediaID    int64       `json:"media_id"`
+	AltText    string      `json:"alt_text"`
+	URL        string      `json:"url"`
+	MimeType   string      `json:"mime_type"`
+	Status     string      `json:"status"`
+	Width      int         `json:"width"`
+	Height     int         `json:"height"`
+	Blurhash   string      `json:"blurhash"`
+	Thumbnails []Thumbnail `json:"thumbnails"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, media *Media) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	INSERT INTO media (user_id, storage_key, url, mime_type, size_bytes, status)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at
+	`
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		media.UserID,
+		media.StorageKey,
+		media.URL,
+		media.MimeType,
+		media.Size,
+		media.Status,
+	).Scan(
+		&media.ID,
+		&media.CreatedAt,
+	)
+}
+
+func (s *MediaStore) GetById(ctx context.Context, id int64) (*Media, error) {
+	return s.getById(ctx, id, nil)
+}
+
+// GetVisibleById is GetById limited to media viewerID uploaded or that is
+// attached to a post viewerID may see. Any other media is reported as
+// ErrNotFound.
+func (s *MediaStore) GetVisibleById(ctx context.Context, id, viewerID int64) (*Media, error) {
+	return s.getById(ctx, id, &viewerID)
+}
+
+func (s *MediaStore) getById(ctx context.Context, id int64, viewerID *int64) (*Media, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT m.id, m.user_id, m.storage_key, m.url, m.mime_type, m.size_bytes, m.status, m.width, m.height, m.blurhash,
+		m.processing_error, m.created_at
+	FROM media m
+	WHERE m.id = $1 AND ($2::bigint IS NULL OR m.user_id = $2 OR EXISTS (
+		SELECT 1 FROM post_attachments pa
+		JOIN posts p ON p.id = pa.post_id
+		WHERE pa.media_id = m.id AND ` + postVisibleTo("p", "$2") + `
+	))
+	`
+	media := &Media{}
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(
+		&media.ID,
+		&media.UserID,
+		&media.StorageKey,
+		&media.URL,
+		&media.MimeType,
+		&media.Size,
+		&media.Status,
+		&media.Width,
+		&media.Height,
+		&media.Blurhash,
+		&media.ProcessingError,
+		&media.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	thumbnails, err := getThumbnailsByMediaIDs(ctx, s.db, []int64{media.ID})
+	if err != nil {
+		return nil, err
+	}
+	media.Thumbnails = thumbnails[media.ID]
+	return media, nil
+}
+
+// GetUnprocessed returns the ids of media still waiting on the image pipeline,
+// oldest first.
+func (s *MediaStore) GetUnprocessed(ctx context.Context) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id FROM media WHERE status IN ('pending', 'processing') ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *MediaStore) SetStatus(ctx context.Context, id int64, status, processingError string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	UPDATE media SET status = $1, processing_error = $2 WHERE id = $3
+	`
+	res, err := s.db.ExecContext(ctx, query, status, processingError, id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CompleteProcessing stores the results of the image pipeline, publishes the
+// url and marks the media as ready.
+func (s *MediaStore) CompleteProcessing(ctx context.Context, media *Media) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE media
+		SET status = $1, size_bytes = $2, width = $3, height = $4, blurhash = $5, url = $6, processing_error = ''
+		WHERE id = $7
+		`
+		media.Status = MediaStatusReady
+		_, err := tx.ExecContext(ctx, query, media.Status, media.Size, media.Width, media.Height, media.Blurhash, media.URL, media.ID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM media_thumbnails WHERE media_id = $1`, media.ID); err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO media_thumbnails (media_id, width, height, storage_key, url, mime_type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		for _, t := range media.Thumbnails {
+			_, err := tx.ExecContext(ctx, query, media.ID, t.Width, t.Height, t.StorageKey, t.URL, t.MimeType)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error {
+	// only media uploaded by the post author can be attached, and only once
+	// it is ready
+	selectQuery := `
+	SELECT url, mime_type, status, width, height, blurhash
+	FROM media WHERE id = $1 AND user_id = $2
+	`
+	insertQuery := `
+	INSERT INTO post_attachments (post_id, media_id, alt_text, position)
+	VALUES ($1, $2, $3, $4)
+	`
+	for i := range post.Attachments {
+		a := &post.Attachments[i]
+		err := tx.QueryRowContext(ctx, selectQuery, a.MediaID, post.UserID).Scan(
+			&a.URL,
+			&a.MimeType,
+			&a.Status,
+			&a.Width,
+			&a.Height,
+			&a.Blurhash,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInvalidMedia
+			default:
+				return err
+			}
+		}
+		if a.Status != MediaStatusReady {
+			return ErrMediaNotReady
+		}
+
+		if _, err := tx.ExecContext(ctx, insertQuery, post.ID, a.MediaID, a.AltText, i); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrInvalidMedia
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func getAttachmentsByPostIDs(ctx context.Context, db *sql.DB, postIDs []int64) (map[int64][]Attachment, error) {
+	query := `
+	SELECT pa.post_id, pa.media_id, pa.alt_text, m.url, m.mime_type, m.status, m.width, m.height, m.blurhash
+	FROM post_attachments pa
+	JOIN media m ON m.id = pa.media_id
+	WHERE pa.post_id = ANY($1)
+	ORDER BY pa.post_id, pa.position
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[int64][]Attachment)
+	mediaIDs := []int64{}
+	for rows.Next() {
+		var postID int64
+		var a Attachment
+		err := rows.Scan(&postID, &a.MediaID, &a.AltText, &a.URL, &a.MimeType, &a.Status, &a.Width, &a.Height, &a.Blurhash)
+		if err != nil {
+			return nil, err
+		}
+		attachments[postID] = append(attachments[postID], a)
+		mediaIDs = append(mediaIDs, a.MediaID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	thumbnails, err := getThumbnailsByMediaIDs(ctx, db, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	for postID := range attachments {
+		for i := range attachments[postID] {
+			attachments[postID][i].Thumbnails = thumbnails[attachments[postID][i].MediaID]
+		}
+	}
+	return attachments, nil
+}
+
+func getThumbnailsByMediaIDs(ctx context.Context, db *sql.DB, mediaIDs []int64) (map[int64][]Thumbnail, error) {
+	query := `
+	SELECT media_id, width, height, storage_key, url, mime_type
+	FROM media_thumbnails
+	WHERE media_id = ANY($1)
+	ORDER BY media_id, width
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(mediaIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thumbnails := make(map[int64][]Thumbnail)
+	for rows.Next() {
+		var mediaID int64
+		var t Thumbnail
+		if err := rows.Scan(&mediaID, &t.Width, &t.Height, &t.StorageKey, &t.URL, &t.MimeType); err != nil {
+			return nil, err
+		}
+		thumbnails[mediaID] = append(thumbnails[mediaID], t)
+	}
+	return thumbnails, rows.Err()
+}
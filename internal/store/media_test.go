@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMediaVisibleToOwnerAndPostReaders(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+
+	media := &Media{UserID: alice.ID, StorageKey: "test/photo.png", MimeType: "image/png", Size: 1, Status: MediaStatusReady}
+	if err := s.Media.Create(ctx, media); err != nil {
+		t.Fatal(err)
+	}
+	visible := func(viewerID int64) bool {
+		t.Helper()
+		_, err := s.Media.GetVisibleById(ctx, media.ID, viewerID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	if !visible(alice.ID) {
+		t.Error("the uploader can't see their unattached media")
+	}
+	if visible(bob.ID) {
+		t.Error("unattached media is visible to others")
+	}
+
+	post := &Post{
+		UserID:      alice.ID,
+		Title:       "photo",
+		Content:     "photo",
+		Visibility:  VisibilityFollowers,
+		Attachments: []Attachment{{MediaID: media.ID}},
+	}
+	if err := s.Posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	if visible(bob.ID) {
+		t.Error("media of a post bob can't see is visible to bob")
+	}
+
+	follow(t, s, bob.ID, alice.ID)
+	if !visible(bob.ID) {
+		t.Error("media of a post bob can see isn't visible to bob")
+	}
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/temideewan/go-social/internal/entities"
+)
+
+// Mention is an @username reference resolved to a user. Start and End are
+// character offsets into the content it was found in.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// UserMention is a place where a user was mentioned.
+type UserMention struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	CommentID *int64 `json:"comment_id"`
+	Content   string `json:"content"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Author    User   `json:"author"`
+	CreatedAt string `json:"created_at"`
+}
+
+type MentionStore struct {
+	db *sql.DB
+}
+
+func (s *MentionStore) GetForUser(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]UserMention, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT m.id, m.post_id, m.comment_id, COALESCE(c.content, p.content), m.start_offset, m.end_offset,
+		m.created_at, u.id, u.username
+	FROM mentions m
+	JOIN posts p ON p.id = m.post_id
+	LEFT JOIN comments c ON c.id = m.comment_id
+	JOIN users u ON u.id = m.author_id
+	WHERE m.mentioned_user_id = $1 AND m.author_id <> $1 AND c.hidden_at IS NULL AND ` + postVisibleTo("p", "$1") + `
+	AND NOT ` + blockedBetween("m.author_id", "$1") + ` AND NOT ` + mutedBy("$1", "m.author_id") + `
+	ORDER BY m.created_at ` + fq.Sort + `, m.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []UserMention{}
+	for rows.Next() {
+		var m UserMention
+		err := rows.Scan(
+			&m.ID,
+			&m.PostID,
+			&m.CommentID,
+			&m.Content,
+			&m.Start,
+			&m.End,
+			&m.CreatedAt,
+			&m.Author.ID,
+			&m.Author.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// saveMentions resolves the @usernames in content and records them. Unknown
+// usernames are left as plain text.
+func saveMentions(ctx context.Context, tx *sql.Tx, postID int64, commentID *int64, authorID int64, content string) ([]Mention, error) {
+	found := entities.Mentions(content)
+	if len(found) == 0 {
+		return []Mention{}, nil
+	}
+
+	usernames := make([]string, len(found))
+	for i, e := range found {
+		usernames[i] = e.Text
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id, username FROM users WHERE username = ANY($1)`, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// usernames are citext, @Alice matches alice, so key the lookup the same
+	// way
+	ids := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		ids[strings.ToLower(username)] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO mentions (post_id, comment_id, author_id, mentioned_user_id, start_offset, end_offset)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	mentions := []Mention{}
+	for _, e := range found {
+		id, ok := ids[strings.ToLower(e.Text)]
+		if !ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, query, postID, commentID, authorID, id, e.Start, e.End); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, Mention{UserID: id, Username: e.Text, Start: e.Start, End: e.End})
+	}
+	return mentions, nil
+}
+
+func deletePostMentions(ctx context.Context, tx *sql.Tx, postID int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM mentions WHERE post_id = $1 AND comment_id IS NULL`, postID)
+	return err
+}
+
+func getMentionsByPostIDs(ctx context.Context, db *sql.DB, postIDs []int64) (map[int64][]Mention, error) {
+	query := `
+	SELECT m.post_id, m.mentioned_user_id, u.username, m.start_offset, m.end_offset
+	FROM mentions m
+	JOIN users u ON u.id = m.mentioned_user_id
+	WHERE m.post_id = ANY($1) AND m.comment_id IS NULL
+	ORDER BY m.post_id, m.start_offset
+	`
+	return queryMentions(ctx, db, query, postIDs)
+}
+
+func getMentionsByCommentIDs(ctx context.Context, db *sql.DB, commentIDs []int64) (map[int64][]Mention, error) {
+	query := `
+	SELECT m.comment_id, m.mentioned_user_id, u.username, m.start_offset, m.end_offset
+	FROM mentions m
+	JOIN users u ON u.id = m.mentioned_user_id
+	WHERE m.comment_id = ANY($1)
+	ORDER BY m.comment_id, m.start_offset
+	`
+	return queryMentions(ctx, db, query, commentIDs)
+}
+
+func queryMentions(ctx context.Context, db *sql.DB, query string, ids []int64) (map[int64][]Mention, error) {
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make(map[int64][]Mention)
+	for rows.Next() {
+		var id int64
+		var m Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		mentions[id] = append(mentions[id], m)
+	}
+	return mentions, rows.Err()
+}
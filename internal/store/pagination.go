@@ -8,13 +8,16 @@ import (
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit int `json:"limit" validate:"gte=1,ltefield=MaxLimit"`
+	// MaxLimit caps Limit, it is set from the config rather than the request
+	MaxLimit int      `json:"-"`
+	Offset   int      `json:"offset" validate:"gte=0"`
+	Sort     string   `json:"sort" validate:"oneof=asc desc"`
+	Tags     []string `json:"tags" validate:"max=5"`
+	Search   string   `json:"search" validate:"max=100"`
+	Since    string   `json:"since"`
+	Until    string   `json:"until"`
+	Cursor   string   `json:"cursor" validate:"max=200"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -36,7 +39,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Offset = o
 	}
 	sort := qs.Get("sort")
-	if offset != "" {
+	if sort != "" {
 		fq.Sort = sort
 	}
 
@@ -58,6 +61,11 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Until = parseTime(until)
 	}
 
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
+
 	return fq, nil
 
 }
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTooManyPins   = errors.New("pinned post limit reached")
+	ErrPinNotAllowed = errors.New("only your own public posts can be pinned")
+)
+
+type PinStore struct {
+	db *sql.DB
+}
+
+// Pin pins one of the user's own public posts to their profile, allowing at
+// most limit pins per user.
+func (s *PinStore) Pin(ctx context.Context, userID, postID int64, limit int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// lock the user so concurrent pins can't go over the limit
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+
+		var allowed bool
+		query := `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND visibility = 'public' AND hidden_at IS NULL)`
+		if err := tx.QueryRowContext(ctx, query, postID, userID).Scan(&allowed); err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrPinNotAllowed
+		}
+
+		var pinned int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pinned_posts WHERE user_id = $1`, userID).Scan(&pinned); err != nil {
+			return err
+		}
+		if pinned >= limit {
+			return ErrTooManyPins
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO pinned_posts (user_id, post_id) VALUES ($1, $2)`, userID, postID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *PinStore) Unpin(ctx context.Context, userID, postID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	DELETE FROM pinned_posts WHERE user_id = $1 AND post_id = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetPinned returns the user's pinned posts, most recently pinned first.
+func (s *PinStore) GetPinned(ctx context.Context, userID, viewerID int64) ([]Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT p.id, p.title, p.content, p.content_html, p.created_at, p.updated_at, p.user_id, p.tags, p.version,
+		p.quote_of_id, p.is_quote, p.visibility, u.id, u.username
+	FROM pinned_posts pp
+	JOIN posts p ON p.id = pp.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE pp.user_id = $1 AND ` + postVisibleTo("p", "$2") + `
+	ORDER BY pp.pinned_at DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.ContentHTML,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.UserID,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.QuoteOfID,
+			&p.IsQuote,
+			&p.Visibility,
+			&p.User.ID,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*Post, len(posts))
+	for i := range posts {
+		ptrs[i] = &posts[i]
+	}
+	if err := loadPostRelations(ctx, s.db, ptrs, &viewerID); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed   = errors.New("this poll is closed and no longer accepts votes")
+	ErrAlreadyVoted = errors.New("you have already voted in this poll")
+	ErrInvalidVote  = errors.New("the selected options are not valid for this poll")
+)
+
+// Poll is attached to a post. Tallies are only filled in once the viewer has
+// voted or the poll has closed, so early results can't sway the vote.
+type Poll struct {
+	ID             int64        `json:"id"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       time.Time    `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	Options        []PollOption `json:"options"`
+	TotalVoters    *int         `json:"total_voters,omitempty"`
+	Voted          bool         `json:"voted"`
+	OwnVotes       []int64      `json:"own_votes"`
+}
+
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+type PollStore struct {
+	db *sql.DB
+}
+
+// Vote records userID's choice in the poll of postID and returns the poll
+// with its tallies.
+func (s *PollStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) (*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	optionIDs = slices.Clone(optionIDs)
+	slices.Sort(optionIDs)
+	optionIDs = slices.Compact(optionIDs)
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var (
+			pollID         int64
+			multipleChoice bool
+			closed         bool
+		)
+		query := `SELECT id, multiple_choice, closes_at <= NOW() FROM polls WHERE post_id = $1`
+		err := tx.QueryRowContext(ctx, query, postID).Scan(&pollID, &multipleChoice, &closed)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if closed {
+			return ErrPollClosed
+		}
+		if len(optionIDs) == 0 || (!multipleChoice && len(optionIDs) > 1) {
+			return ErrInvalidVote
+		}
+
+		var matched int
+		query = `SELECT COUNT(*) FROM poll_options WHERE poll_id = $1 AND id = ANY($2)`
+		if err := tx.QueryRowContext(ctx, query, pollID, pq.Array(optionIDs)).Scan(&matched); err != nil {
+			return err
+		}
+		if matched != len(optionIDs) {
+			return ErrInvalidVote
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO poll_voters (poll_id, user_id) VALUES ($1, $2)`, pollID, userID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrAlreadyVoted
+			}
+			return err
+		}
+
+		query = `
+		INSERT INTO poll_votes (poll_id, option_id, user_id)
+		SELECT $1, unnest($2::bigint[]), $3
+		`
+		_, err = tx.ExecContext(ctx, query, pollID, pq.Array(optionIDs), userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	polls, err := getPollsByPostIDs(ctx, s.db, []int64{postID}, &userID)
+	if err != nil {
+		return nil, err
+	}
+	return polls[postID], nil
+}
+
+func createPoll(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `
+	INSERT INTO polls (post_id, multiple_choice, closes_at) VALUES ($1, $2, $3) RETURNING id
+	`
+	if err := tx.QueryRowContext(ctx, query, postID, poll.MultipleChoice, poll.ClosesAt).Scan(&poll.ID); err != nil {
+		return err
+	}
+
+	for i := range poll.Options {
+		query := `INSERT INTO poll_options (poll_id, position, text) VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRowContext(ctx, query, poll.ID, i, poll.Options[i].Text).Scan(&poll.Options[i].ID); err != nil {
+			return err
+		}
+	}
+	poll.OwnVotes = []int64{}
+	return nil
+}
+
+func getPollsByPostIDs(ctx context.Context, db *sql.DB, postIDs []int64, viewerID *int64) (map[int64]*Poll, error) {
+	polls := make(map[int64]*Poll)
+	if len(postIDs) == 0 {
+		return polls, nil
+	}
+
+	query := `
+	SELECT p.id, p.post_id, p.multiple_choice, p.closes_at, p.closes_at <= NOW(),
+		(SELECT COUNT(*) FROM poll_voters v WHERE v.poll_id = p.id)
+	FROM polls p
+	WHERE p.post_id = ANY($1)
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Poll)
+	pollIDs := []int64{}
+	for rows.Next() {
+		var (
+			postID int64
+			total  int
+		)
+		p := &Poll{OwnVotes: []int64{}}
+		if err := rows.Scan(&p.ID, &postID, &p.MultipleChoice, &p.ClosesAt, &p.Closed, &total); err != nil {
+			return nil, err
+		}
+		p.TotalVoters = &total
+		polls[postID] = p
+		byID[p.ID] = p
+		pollIDs = append(pollIDs, p.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pollIDs) == 0 {
+		return polls, nil
+	}
+
+	query = `
+	SELECT o.id, o.poll_id, o.text, COUNT(v.user_id)
+	FROM poll_options o
+	LEFT JOIN poll_votes v ON v.option_id = o.id
+	WHERE o.poll_id = ANY($1)
+	GROUP BY o.id
+	ORDER BY o.poll_id, o.position
+	`
+	optionRows, err := db.QueryContext(ctx, query, pq.Array(pollIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var (
+			o      PollOption
+			pollID int64
+			votes  int
+		)
+		if err := optionRows.Scan(&o.ID, &pollID, &o.Text, &votes); err != nil {
+			return nil, err
+		}
+		o.Votes = &votes
+		byID[pollID].Options = append(byID[pollID].Options, o)
+	}
+	if err := optionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if viewerID != nil {
+		query = `SELECT poll_id, option_id FROM poll_votes WHERE poll_id = ANY($1) AND user_id = $2 ORDER BY option_id`
+		voteRows, err := db.QueryContext(ctx, query, pq.Array(pollIDs), *viewerID)
+		if err != nil {
+			return nil, err
+		}
+		defer voteRows.Close()
+
+		for voteRows.Next() {
+			var pollID, optionID int64
+			if err := voteRows.Scan(&pollID, &optionID); err != nil {
+				return nil, err
+			}
+			byID[pollID].Voted = true
+			byID[pollID].OwnVotes = append(byID[pollID].OwnVotes, optionID)
+		}
+		if err := voteRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range polls {
+		if !p.Voted && !p.Closed {
+			p.TotalVoters = nil
+			for i := range p.Options {
+				p.Options[i].Votes = nil
+			}
+		}
+	}
+	return polls, nil
+}
@@ -4,79 +4,189 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/temideewan/go-social/internal/markdown"
 )
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID          int64     `json:"id"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"`
+	Title       string    `json:"title"`
+	UserID      int64     `json:"user_id"`
+	Visibility  string    `json:"visibility"`
+	Tags        []string  `json:"tags"`
+	Hashtags    []Hashtag `json:"hashtags"`
+	// ExplicitTags are the tags the author sent, Tags also holds the
+	// hashtags found in the title and content
+	ExplicitTags []string     `json:"-"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at"`
+	Version      int          `json:"version"`
+	Comments     []Comment    `json:"comments"`
+	User         User         `json:"user"`
+	Attachments  []Attachment `json:"attachments"`
+	Mentions     []Mention    `json:"mentions"`
+	QuoteOfID    *int64       `json:"quote_of_id"`
+	IsQuote      bool         `json:"is_quote"`
+	QuotedPost   *QuotedPost  `json:"quoted_post,omitempty"`
+	Poll         *Poll        `json:"poll,omitempty"`
+	LinkPreview  *LinkPreview `json:"link_preview,omitempty"`
+	// HeldForReview is set on create when a content filter held the post
+	// back for moderation, HoldReason says why
+	HeldForReview bool   `json:"held_for_review,omitempty"`
+	HoldReason    string `json:"-"`
 }
 
 type PostWithMetadata struct {
 	Post
 	CommentCount int `json:"comments_count"`
+	RepostCount  int `json:"reposts_count"`
+	QuoteCount   int `json:"quotes_count"`
+	// RepostedBy is set when the post is in a feed because someone the
+	// reader follows reposted it
+	RepostedBy *User `json:"reposted_by,omitempty"`
+	// ActivityAt is when the post entered the feed, it positions feed cursors
+	ActivityAt time.Time `json:"-"`
+	// Pinned is set on the pinned posts leading a profile timeline
+	Pinned bool `json:"pinned,omitempty"`
 }
 
 type PostStore struct {
 	db *sql.DB
 }
 
+// Create stores a new post. post.Tags are taken as the explicit tags of the
+// author and get merged with the hashtags in the title and content.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	query := `
-	INSERT INTO posts (content, title, user_id, tags)
-	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+	INSERT INTO posts (content, content_html, title, user_id, tags, explicit_tags, quote_of_id, is_quote, visibility, hidden_at, link_preview_pending)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CASE WHEN $10 THEN NOW() END, $11) RETURNING id, created_at, updated_at
 	`
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
+	post.ExplicitTags = mergeTags(post.Tags, nil)
+	if err := resolveTags(post); err != nil {
+		return err
+	}
 
+	contentHTML, err := markdown.Render(post.Content)
 	if err != nil {
 		return err
 	}
+	post.ContentHTML = contentHTML
 
-	return nil
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if post.QuoteOfID != nil {
+			// a post the author can't see is treated as missing, so quoting
+			// doesn't tell whether it exists
+			var visible bool
+			err := tx.QueryRowContext(
+				ctx,
+				`SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND `+postVisibleTo("p", "$2")+`)`,
+				*post.QuoteOfID,
+				post.UserID,
+			).Scan(&visible)
+			if err != nil {
+				return err
+			}
+			if !visible {
+				return ErrInvalidQuote
+			}
+		}
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.ContentHTML,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			pq.Array(post.ExplicitTags),
+			post.QuoteOfID,
+			post.QuoteOfID != nil,
+			post.Visibility,
+			post.HeldForReview,
+			hasURL(post.Content),
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+		)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" && pqErr.Constraint == "posts_quote_of_id_fkey" {
+				return ErrInvalidQuote
+			}
+			return err
+		}
+		post.IsQuote = post.QuoteOfID != nil
+
+		if err := attachMedia(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if post.Poll != nil {
+			if err := createPoll(ctx, tx, post.ID, post.Poll); err != nil {
+				return err
+			}
+		}
+
+		if post.HeldForReview {
+			if err := holdForReview(ctx, tx, ReportTargetPost, post.ID, post.HoldReason); err != nil {
+				return err
+			}
+		}
+
+		post.Mentions, err = saveMentions(ctx, tx, post.ID, nil, post.UserID, post.Content)
+		return err
+	})
 }
 
 func (s *PostStore) GetById(ctx context.Context, id int64) (*Post, error) {
+	return s.getById(ctx, id, nil)
+}
+
+// GetVisibleById is GetById limited to posts viewerID may see. Hidden posts
+// are reported as ErrNotFound so their existence doesn't leak.
+func (s *PostStore) GetVisibleById(ctx context.Context, id, viewerID int64) (*Post, error) {
+	return s.getById(ctx, id, &viewerID)
+}
+
+func (s *PostStore) getById(ctx context.Context, id int64, viewerID *int64) (*Post, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	var post Post
 	query := `
-	SELECT id,title,content,created_at,updated_at,user_id, tags, version FROM posts WHERE id = $1
+	SELECT p.id, p.title, p.content, p.content_html, p.created_at, p.updated_at, p.user_id, p.tags, p.explicit_tags,
+		p.version, p.quote_of_id, p.is_quote, p.visibility
+	FROM posts p WHERE p.id = $1 AND ($2::bigint IS NULL OR ` + postVisibleTo("p", "$2") + `)
 	`
 	err := s.db.QueryRowContext(
 		ctx,
 		query,
 		id,
+		viewerID,
 	).Scan(
 		&post.ID,
 		&post.Title,
 		&post.Content,
+		&post.ContentHTML,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.UserID,
 		pq.Array(&post.Tags),
+		pq.Array(&post.ExplicitTags),
 		&post.Version,
+		&post.QuoteOfID,
+		&post.IsQuote,
+		&post.Visibility,
 	)
 	if err != nil {
 		switch {
@@ -86,39 +196,251 @@ func (s *PostStore) GetById(ctx context.Context, id int64) (*Post, error) {
 			return nil, err
 		}
 	}
+
+	if err := loadPostRelations(ctx, s.db, []*Post{&post}, viewerID); err != nil {
+		return nil, err
+	}
 	return &post, nil
 }
 
-func (s *PostStore) GetAllPosts(ctx context.Context) ([]Post, error) {
+// GetAllPosts lists the posts viewerID can see, newest first by default,
+// optionally limited to the posts of authorID.
+func (s *PostStore) GetAllPosts(ctx context.Context, viewerID int64, authorID *int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	query := `
-	SELECT p.id, p.title,p.content,p.created_at,p.updated_at,p.user_id, p.tags, p.version FROM posts p
-	ORDER BY p.id
+	SELECT
+		p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.updated_at, p.version, p.tags,
+		p.quote_of_id, p.is_quote, p.visibility, u.id, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count,
+		(SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count,
+		(SELECT COUNT(*) FROM posts q WHERE q.quote_of_id = p.id) AS quotes_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE ($4::bigint IS NULL OR p.user_id = $4)
+	AND (p.title ILIKE '%' || $5 || '%' OR p.content ILIKE '%' || $5 || '%')
+	AND (p.tags @> $6 OR $6 = '{}')
+	AND ($7 = '' OR p.created_at >= NULLIF($7, '')::timestamptz)
+	AND ($8 = '' OR p.created_at <= NULLIF($8, '')::timestamptz)
+	AND ` + postVisibleTo("p", "$1") + `
+	ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+	LIMIT $2 OFFSET $3
 	`
-	rows, err := s.db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		viewerID,
+		fq.Limit,
+		fq.Offset,
+		authorID,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+	)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrNotFound
-		default:
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.ContentHTML,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.QuoteOfID,
+			&p.IsQuote,
+			&p.Visibility,
+			&p.User.ID,
+			&p.User.Username,
+			&p.CommentCount,
+			&p.RepostCount,
+			&p.QuoteCount,
+		)
+		if err != nil {
 			return nil, err
 		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	posts := []Post{}
 
-	for rows.Next() {
-		post := Post{}
+	ptrs := make([]*Post, len(posts))
+	for i := range posts {
+		ptrs[i] = &posts[i].Post
+	}
+	if err := loadPostRelations(ctx, s.db, ptrs, &viewerID); err != nil {
+		return nil, err
+	}
 
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CreatedAt, &post.UpdatedAt, &post.UserID, pq.Array(&post.Tags), &post.Version)
+	return posts, nil
+}
+
+// Profile timeline tabs.
+const (
+	TimelinePosts   = "posts"
+	TimelineReplies = "replies"
+	TimelineMedia   = "media"
+)
+
+// GetUserTimeline pages through what userID posted, as seen by viewerID.
+// The posts tab has the user's posts and reposts, the replies tab adds the
+// posts the user commented on and the media tab only has the user's posts
+// with attachments. A post shows up once, at the user's latest activity on
+// it. On the posts tab the pinned posts lead the first page, most recently
+// pinned first, and are left out of the rest of the list. A cursor takes
+// precedence over the offset.
+func (s *PostStore) GetUserTimeline(ctx context.Context, userID, viewerID int64, tab string, fq PaginatedFeedQuery) ([]PostWithMetadata, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+	offset := fq.Offset
+	if k.After != nil {
+		offset = 0
+	}
+	firstPage := k.After == nil && offset == 0
+
+	query := `
+		WITH pins AS (
+			SELECT post_id, pinned_at FROM pinned_posts WHERE user_id = $1 AND $9 = 'posts'
+		),
+		entries AS (
+			SELECT p.id AS post_id, p.created_at AS activity_at, NULL::bigint AS reposted_by
+			FROM posts p
+			WHERE p.user_id = $1
+			AND ($9 <> 'media' OR EXISTS (SELECT 1 FROM post_attachments pa WHERE pa.post_id = p.id))
+			UNION ALL
+			SELECT r.post_id, r.created_at, r.user_id
+			FROM reposts r
+			WHERE r.user_id = $1 AND $9 <> 'media'
+			UNION ALL
+			SELECT c.post_id, c.created_at, NULL
+			FROM comments c
+			WHERE c.user_id = $1 AND c.hidden_at IS NULL AND $9 = 'replies'
+		),
+		latest AS (
+			SELECT DISTINCT ON (post_id) post_id, activity_at, reposted_by
+			FROM entries
+			ORDER BY post_id, activity_at DESC, reposted_by NULLS FIRST
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags,
+			p.quote_of_id, p.is_quote, p.visibility, u.id, u.username, ru.id, ru.username,
+			l.activity_at, pn.pinned_at IS NOT NULL,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count,
+			(SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count,
+			(SELECT COUNT(*) FROM posts q WHERE q.quote_of_id = p.id) AS quotes_count
+		FROM latest l
+		JOIN posts p ON p.id = l.post_id
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN users ru ON ru.id = l.reposted_by
+		LEFT JOIN pins pn ON pn.post_id = l.post_id
+		WHERE u.suspended_at IS NULL
+		AND (p.title ILIKE '%' || $5 || '%' OR p.content ILIKE '%' || $5 || '%')
+		AND (p.tags @> $6 OR $6 = '{}')
+		AND ($7 = '' OR l.activity_at >= NULLIF($7, '')::timestamptz)
+		AND ($8 = '' OR l.activity_at <= NULLIF($8, '')::timestamptz)
+		AND CASE WHEN pn.pinned_at IS NOT NULL THEN $12
+			ELSE $10::timestamptz IS NULL OR (l.activity_at, p.id) ` + k.Compare + ` ($10, $11) END
+		AND NOT ` + blockedBetween("$1", "$2") + `
+		AND ` + postVisibleTo("p", "$2") + `
+		ORDER BY pn.pinned_at DESC NULLS LAST, l.activity_at ` + k.Order + `, p.id ` + k.Order + `
+		LIMIT $3 + (SELECT COUNT(*) FROM pinned_posts WHERE user_id = $1 AND $12) OFFSET $4
+	`
+	// fetch one extra row to know whether there is a next page, the pinned
+	// posts come on top of the limit
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		viewerID,
+		fq.Limit+1,
+		offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+		tab,
+		afterTime,
+		afterID,
+		firstPage,
+	)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
 
+	pinned := []PostWithMetadata{}
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		var reposterID sql.NullInt64
+		var reposterUsername sql.NullString
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.ContentHTML,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.QuoteOfID,
+			&p.IsQuote,
+			&p.Visibility,
+			&p.User.ID,
+			&p.User.Username,
+			&reposterID,
+			&reposterUsername,
+			&p.ActivityAt,
+			&p.Pinned,
+			&p.CommentCount,
+			&p.RepostCount,
+			&p.QuoteCount,
+		)
 		if err != nil {
-			return nil, err
+			return nil, Cursors{}, err
 		}
-		posts = append(posts, post)
+		if reposterID.Valid {
+			p.RepostedBy = &User{ID: reposterID.Int64, Username: reposterUsername.String}
+		}
+		if p.Pinned {
+			pinned = append(pinned, p)
+		} else {
+			posts = append(posts, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
 	}
+	// the cursors only cover the chronological part of the page
+	posts, cursors := pageCursors(posts, fq.Limit, k, !firstPage, func(p PostWithMetadata) cursor {
+		return cursor{CreatedAt: p.ActivityAt, ID: p.ID}
+	})
+	posts = append(pinned, posts...)
 
-	return posts, nil
+	ptrs := make([]*Post, len(posts))
+	for i := range posts {
+		ptrs[i] = &posts[i].Post
+	}
+	if err := loadPostRelations(ctx, s.db, ptrs, &viewerID); err != nil {
+		return nil, Cursors{}, err
+	}
+	return posts, cursors, nil
 }
 
 func (s *PostStore) DeleteById(ctx context.Context, id int64) error {
@@ -147,62 +469,159 @@ func (s *PostStore) UpdatePost(ctx context.Context, post *Post) error {
 	defer cancel()
 	query := `
 	UPDATE posts 
-	SET title=$1, content=$2, version = version + 1
-	WHERE id=$3 AND version=$4
-	RETURNING id, user_id, created_at, updated_at, tags, version
+	SET title=$1, content=$2, content_html=$3, tags=$4, visibility=$5, version = version + 1,
+		link_preview_pending = link_preview_pending OR (content <> $2 AND ($8 OR link_preview_id IS NOT NULL))
+	WHERE id=$6 AND version=$7
+	RETURNING id, user_id, created_at, updated_at, tags, version, quote_of_id, is_quote, visibility
 	`
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.ID, &post.UserID, &post.CreatedAt, &post.UpdatedAt, pq.Array(&post.Tags), &post.Version)
+	if err := resolveTags(post); err != nil {
+		return err
+	}
+
+	contentHTML, err := markdown.Render(post.Content)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+		return err
+	}
+	post.ContentHTML = contentHTML
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ContentHTML, pq.Array(post.Tags), post.Visibility, post.ID, post.Version, hasURL(post.Content)).Scan(&post.ID, &post.UserID, &post.CreatedAt, &post.UpdatedAt, pq.Array(&post.Tags), &post.Version, &post.QuoteOfID, &post.IsQuote, &post.Visibility)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := deletePostMentions(ctx, tx, post.ID); err != nil {
 			return err
 		}
+		// only public posts stay pinned
+		if post.Visibility != VisibilityPublic {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM pinned_posts WHERE post_id = $1`, post.ID); err != nil {
+				return err
+			}
+		}
+		post.Mentions, err = saveMentions(ctx, tx, post.ID, nil, post.UserID, post.Content)
+		return err
+	})
+}
+
+// loadPostRelations fills in the attachments, mentions and quoted posts of
+// posts with one query per relation, along with their hashtag entities.
+// Quoted posts viewerID can't see are shown as tombstones, a nil viewerID
+// skips the check.
+func loadPostRelations(ctx context.Context, db *sql.DB, posts []*Post, viewerID *int64) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	attachments, err := getAttachmentsByPostIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	mentions, err := getMentionsByPostIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+
+	polls, err := getPollsByPostIDs(ctx, db, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	previews, err := getLinkPreviewsByPostIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+
+	quoteIDs := []int64{}
+	for _, p := range posts {
+		if p.QuoteOfID != nil {
+			quoteIDs = append(quoteIDs, *p.QuoteOfID)
+		}
+	}
+	quoted, err := getQuotedPosts(ctx, db, quoteIDs, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Attachments = attachments[p.ID]
+		p.Mentions = mentions[p.ID]
+		p.Hashtags = extractHashtags(p.Title, p.Content)
+		p.Poll = polls[p.ID]
+		p.LinkPreview = previews[p.ID]
+		if p.QuoteOfID != nil {
+			if q, ok := quoted[*p.QuoteOfID]; ok {
+				p.QuotedPost = &q
+			}
+		}
+		if p.IsQuote && p.QuotedPost == nil {
+			// the quoted post was deleted or is hidden from the viewer
+			p.QuotedPost = &QuotedPost{Deleted: true}
+		}
 	}
 	return nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+// BackfillTags recomputes the tags of up to limit posts with an id greater
+// than afterID, so hashtags in older posts are covered by the tags index.
+// It returns the last id it looked at and how many posts changed.
+func (s *PostStore) BackfillTags(ctx context.Context, afterID int64, limit int) (int64, int, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	query := `
-		SELECT 
-			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username,
-			COUNT(c.id) AS comments_count
-		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON u.id = p.user_id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE f.user_id = $1 AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-		(p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
-		LIMIT $2 OFFSET $3
+	SELECT id, title, content, tags, COALESCE(explicit_tags, tags, '{}')
+	FROM posts WHERE id > $1 ORDER BY id LIMIT $2
 	`
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
 	if err != nil {
-		return nil, err
+		return afterID, 0, err
 	}
 	defer rows.Close()
-	var feed []PostWithMetadata
+
+	posts := []Post{}
 	for rows.Next() {
-		var p PostWithMetadata
-		err := rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentCount,
-		)
-		if err != nil {
-			return nil, err
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Title, &p.Content, pq.Array(&p.Tags), pq.Array(&p.ExplicitTags)); err != nil {
+			return afterID, 0, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return afterID, 0, err
+	}
+	if len(posts) == 0 {
+		return afterID, 0, nil
+	}
+
+	updated := 0
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		for _, p := range posts {
+			tags := mergeTags(p.ExplicitTags, extractHashtags(p.Title, p.Content))
+			// historical posts may go over the limit, keep what fits
+			if len(tags) > MaxPostTags {
+				tags = tags[:MaxPostTags]
+			}
+			if slices.Equal(tags, p.Tags) {
+				continue
+			}
+
+			_, err := tx.ExecContext(ctx, `UPDATE posts SET tags = $1, explicit_tags = $2 WHERE id = $3`, pq.Array(tags), pq.Array(p.ExplicitTags), p.ID)
+			if err != nil {
+				return err
+			}
+			updated++
 		}
-		feed = append(feed, p)
+		return nil
+	})
+	if err != nil {
+		return afterID, 0, err
 	}
-	return feed, nil
+
+	return posts[len(posts)-1].ID, updated, nil
 }
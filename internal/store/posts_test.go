@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestQuoteNeedsVisiblePost(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+
+	hidden := &Post{UserID: alice.ID, Title: "hidden", Content: "hidden", Visibility: VisibilityFollowers}
+	if err := s.Posts.Create(ctx, hidden); err != nil {
+		t.Fatal(err)
+	}
+	missing := hidden.ID + 1000
+
+	// a post bob can't see looks the same as one that doesn't exist
+	for _, quoteOf := range []int64{hidden.ID, missing} {
+		quote := &Post{UserID: bob.ID, Title: "quote", Content: "quote", QuoteOfID: &quoteOf}
+		if err := s.Posts.Create(ctx, quote); !errors.Is(err, ErrInvalidQuote) {
+			t.Errorf("quoting post %d returned %v, want ErrInvalidQuote", quoteOf, err)
+		}
+	}
+
+	follow(t, s, bob.ID, alice.ID)
+	quote := &Post{UserID: bob.ID, Title: "quote", Content: "quote", QuoteOfID: &hidden.ID}
+	if err := s.Posts.Create(ctx, quote); err != nil {
+		t.Errorf("quoting a post of a followed account: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+
+	ModerationDismiss = "dismiss"
+	ModerationHide    = "hide"
+	ModerationWarn    = "warn"
+	ModerationSuspend = "suspend"
+)
+
+var (
+	ErrReportResolved = errors.New("the report has already been resolved")
+	ErrInvalidAction  = errors.New("this action can't be applied to the reported content")
+)
+
+const reportReasonFilter = "filter"
+
+// Report is a complaint about a post, comment or user. Reports filed by the
+// content filters have no reporter and the reason "filter".
+type Report struct {
+	ID         int64   `json:"id"`
+	ReporterID *int64  `json:"reporter_id"`
+	TargetType string  `json:"target_type"`
+	TargetID   int64   `json:"target_id"`
+	Reason     string  `json:"reason"`
+	Details    string  `json:"details"`
+	Status     string  `json:"status"`
+	Resolution *string `json:"resolution"`
+	ResolvedBy *int64  `json:"resolved_by"`
+	ResolvedAt *string `json:"resolved_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// ModerationAction records what a moderator did about a report.
+// TargetUserID is the user the action applies to, the author in the case
+// of a post or comment.
+type ModerationAction struct {
+	ID           int64  `json:"id"`
+	ReportID     int64  `json:"report_id"`
+	ModeratorID  int64  `json:"moderator_id"`
+	Action       string `json:"action"`
+	TargetType   string `json:"target_type"`
+	TargetID     int64  `json:"target_id"`
+	TargetUserID *int64 `json:"target_user_id"`
+	Note         string `json:"note"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type ReportQuery struct {
+	Status     string `json:"status" validate:"oneof=open resolved"`
+	TargetType string `json:"target_type" validate:"omitempty,oneof=post comment user"`
+	Reason     string `json:"reason" validate:"omitempty,oneof=spam harassment hate violence nudity misinformation other filter"`
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset     int    `json:"offset" validate:"gte=0"`
+}
+
+func (q ReportQuery) Parse(r *http.Request) (ReportQuery, error) {
+	qs := r.URL.Query()
+	if status := qs.Get("status"); status != "" {
+		q.Status = status
+	}
+	if targetType := qs.Get("target_type"); targetType != "" {
+		q.TargetType = targetType
+	}
+	if reason := qs.Get("reason"); reason != "" {
+		q.Reason = reason
+	}
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+		q.Offset = o
+	}
+	return q, nil
+}
+
+type ReportStore struct {
+	db *sql.DB
+}
+
+// Create files a report. The target has to exist and be visible to the
+// reporter, otherwise ErrNotFound is returned.
+func (s *ReportStore) Create(ctx context.Context, report *Report) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	exists := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`
+	args := []any{report.TargetID}
+	switch report.TargetType {
+	case ReportTargetPost:
+		exists = `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND ` + postVisibleTo("p", "$2") + `)`
+		args = append(args, report.ReporterID)
+	case ReportTargetComment:
+		exists = `
+		SELECT EXISTS (
+			SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id
+			WHERE c.id = $1 AND c.hidden_at IS NULL AND ` + postVisibleTo("p", "$2") + `
+		)`
+		args = append(args, report.ReporterID)
+	}
+	var found bool
+	if err := s.db.QueryRowContext(ctx, exists, args...).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	query := `
+	INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, status, created_at
+	`
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		report.ReporterID,
+		report.TargetType,
+		report.TargetID,
+		report.Reason,
+		report.Details,
+	).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// GetAll lists reports for the review queue, oldest first.
+func (s *ReportStore) GetAll(ctx context.Context, q ReportQuery) ([]Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id, reporter_id, target_type, target_id, reason, details, status, resolution, resolved_by, resolved_at, created_at
+	FROM reports
+	WHERE status = $1 AND ($2 = '' OR target_type = $2) AND ($3 = '' OR reason = $3)
+	ORDER BY created_at, id
+	LIMIT $4 OFFSET $5
+	`
+	rows, err := s.db.QueryContext(ctx, query, q.Status, q.TargetType, q.Reason, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var r Report
+		err := rows.Scan(
+			&r.ID,
+			&r.ReporterID,
+			&r.TargetType,
+			&r.TargetID,
+			&r.Reason,
+			&r.Details,
+			&r.Status,
+			&r.Resolution,
+			&r.ResolvedBy,
+			&r.ResolvedAt,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// Resolve closes an open report with the given action, applies it and
+// records it in the moderation log.
+func (s *ReportStore) Resolve(ctx context.Context, reportID, moderatorID int64, action, note string) (*ModerationAction, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	ma := &ModerationAction{
+		ReportID:    reportID,
+		ModeratorID: moderatorID,
+		Action:      action,
+		Note:        note,
+	}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var status, reason string
+		query := `SELECT target_type, target_id, status, reason FROM reports WHERE id = $1 FOR UPDATE`
+		err := tx.QueryRowContext(ctx, query, reportID).Scan(&ma.TargetType, &ma.TargetID, &status, &reason)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if status != ReportStatusOpen {
+			return ErrReportResolved
+		}
+
+		// tables are picked from constants, never from input
+		table := map[string]string{
+			ReportTargetPost:    "posts",
+			ReportTargetComment: "comments",
+			ReportTargetUser:    "users",
+		}[ma.TargetType]
+		authorColumn := "user_id"
+		if ma.TargetType == ReportTargetUser {
+			authorColumn = "id"
+		}
+
+		var targetUserID int64
+		err = tx.QueryRowContext(ctx, `SELECT `+authorColumn+` FROM `+table+` WHERE id = $1`, ma.TargetID).Scan(&targetUserID)
+		switch {
+		case err == nil:
+			ma.TargetUserID = &targetUserID
+		case errors.Is(err, sql.ErrNoRows):
+			// the target was deleted since it was reported
+			if action != ModerationDismiss {
+				return ErrInvalidAction
+			}
+		default:
+			return err
+		}
+
+		switch action {
+		case ModerationDismiss:
+			// content held back by a filter is published once cleared
+			if reason == reportReasonFilter && ma.TargetType != ReportTargetUser {
+				if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET hidden_at = NULL WHERE id = $1`, ma.TargetID); err != nil {
+					return err
+				}
+			}
+		case ModerationHide:
+			if ma.TargetType == ReportTargetUser {
+				return ErrInvalidAction
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET hidden_at = NOW() WHERE id = $1`, ma.TargetID); err != nil {
+				return err
+			}
+			if ma.TargetType == ReportTargetPost {
+				if _, err := tx.ExecContext(ctx, `DELETE FROM pinned_posts WHERE post_id = $1`, ma.TargetID); err != nil {
+					return err
+				}
+			}
+		case ModerationSuspend:
+			query := `UPDATE users SET suspended_at = NOW() WHERE id = $1 AND suspended_at IS NULL`
+			if _, err := tx.ExecContext(ctx, query, *ma.TargetUserID); err != nil {
+				return err
+			}
+		}
+
+		query = `
+		INSERT INTO moderation_actions (report_id, moderator_id, action, target_type, target_id, target_user_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at
+		`
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			ma.ReportID,
+			ma.ModeratorID,
+			ma.Action,
+			ma.TargetType,
+			ma.TargetID,
+			ma.TargetUserID,
+			ma.Note,
+		).Scan(&ma.ID, &ma.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		query = `
+		UPDATE reports SET status = 'resolved', resolution = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE id = $1
+		`
+		_, err = tx.ExecContext(ctx, query, reportID, action, moderatorID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ma, nil
+}
+
+// holdForReview queues content that a filter held back in the moderation
+// queue. The content itself is stored hidden until a moderator dismisses the
+// report.
+func holdForReview(ctx context.Context, tx *sql.Tx, targetType string, targetID int64, reason string) error {
+	query := `
+	INSERT INTO reports (target_type, target_id, reason, details) VALUES ($1, $2, $3, $4)
+	`
+	_, err := tx.ExecContext(ctx, query, targetType, targetID, reportReasonFilter, reason)
+	return err
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidQuote = errors.New("the quoted post does not exist")
+
+// QuotedPost is the post a quote refers to. Deleted marks a tombstone left
+// behind when the original post was removed, or shown in its place when the
+// reader isn't allowed to see it.
+type QuotedPost struct {
+	ID          int64  `json:"id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Content     string `json:"content,omitempty"`
+	ContentHTML string `json:"content_html,omitempty"`
+	UserID      int64  `json:"user_id,omitempty"`
+	User        *User  `json:"user,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	Deleted     bool   `json:"deleted"`
+}
+
+type RepostStore struct {
+	db *sql.DB
+}
+
+func (s *RepostStore) Repost(ctx context.Context, userID, postID int64) error {
+	query := `
+	INSERT INTO reposts (user_id, post_id) VALUES ($1, $2)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrConflict
+			case "23503":
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *RepostStore) Unrepost(ctx context.Context, userID, postID int64) error {
+	query := `
+	DELETE FROM reposts WHERE user_id = $1 AND post_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func getQuotedPosts(ctx context.Context, db *sql.DB, ids []int64, viewerID *int64) (map[int64]QuotedPost, error) {
+	quoted := make(map[int64]QuotedPost)
+	if len(ids) == 0 {
+		return quoted, nil
+	}
+
+	query := `
+	SELECT p.id, p.title, p.content, p.content_html, p.user_id, u.username, p.created_at
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id = ANY($1) AND ($2::bigint IS NULL OR ` + postVisibleTo("p", "$2") + `)
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		q := QuotedPost{User: &User{}}
+		err := rows.Scan(&q.ID, &q.Title, &q.Content, &q.ContentHTML, &q.UserID, &q.User.Username, &q.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		q.User.ID = q.UserID
+		quoted[q.ID] = q
+	}
+	return quoted, rows.Err()
+}
@@ -17,34 +17,126 @@ type Storage struct {
 	Posts interface {
 		Create(ctx context.Context, post *Post) error
 		GetById(ctx context.Context, id int64) (*Post, error)
+		GetVisibleById(ctx context.Context, id, viewerID int64) (*Post, error)
 		DeleteById(ctx context.Context, id int64) error
-		GetAllPosts(ctx context.Context) ([]Post, error)
+		GetAllPosts(ctx context.Context, viewerID int64, authorID *int64, query PaginatedFeedQuery) ([]PostWithMetadata, error)
 		UpdatePost(ctx context.Context, post *Post) error
-		GetUserFeed(ctx context.Context, userId int64, query PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetUserTimeline(ctx context.Context, userID, viewerID int64, tab string, query PaginatedFeedQuery) ([]PostWithMetadata, Cursors, error)
+		BackfillTags(ctx context.Context, afterID int64, limit int) (int64, int, error)
 	}
 	Users interface {
 		Create(ctx context.Context, tx *sql.Tx, user *User) error
 		GetById(ctx context.Context, id int64) (*User, error)
+		GetByUsername(ctx context.Context, username string) (*User, error)
+		GetRenamedUsername(ctx context.Context, username string) (string, error)
+		ChangeUsername(ctx context.Context, user *User, username string, cooldown time.Duration) error
 		CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error
 		Activate(ctx context.Context, token string) error
+		UpdateProfile(ctx context.Context, user *User) error
+		Search(ctx context.Context, viewerID int64, query UserSearchQuery) ([]User, error)
+		GetSuggestions(ctx context.Context, userID int64, limit int) ([]SuggestedUser, error)
 	}
 	Comments interface {
-		GetByPostId(ctx context.Context, id int64) ([]Comment, error)
+		GetByPostId(ctx context.Context, id, viewerID int64) ([]Comment, error)
 		Create(ctx context.Context, comment *Comment) error
 	}
 
 	Followers interface {
-		Follow(ctx context.Context, followerId int64, followeeId int64) error
+		Follow(ctx context.Context, followerId int64, followeeId int64) (bool, error)
 		Unfollow(ctx context.Context, followerId int64, followeeId int64) error
+		IsFollowing(ctx context.Context, followerID, userID int64) (bool, error)
+		GetFollowers(ctx context.Context, userID, viewerID int64, query PaginatedFeedQuery) ([]FollowListEntry, Cursors, error)
+		GetFollowing(ctx context.Context, userID, viewerID int64, query PaginatedFeedQuery) ([]FollowListEntry, Cursors, error)
+		GetFollowRequests(ctx context.Context, userID int64, query PaginatedFeedQuery) ([]FollowRequest, Cursors, error)
+		AcceptFollowRequest(ctx context.Context, userID, requesterID int64) error
+		RejectFollowRequest(ctx context.Context, userID, requesterID int64) error
+	}
+	Media interface {
+		Create(ctx context.Context, media *Media) error
+		GetById(ctx context.Context, id int64) (*Media, error)
+		GetVisibleById(ctx context.Context, id, viewerID int64) (*Media, error)
+		GetUnprocessed(ctx context.Context) ([]int64, error)
+		SetStatus(ctx context.Context, id int64, status, processingError string) error
+		CompleteProcessing(ctx context.Context, media *Media) error
+	}
+	Reposts interface {
+		Repost(ctx context.Context, userID, postID int64) error
+		Unrepost(ctx context.Context, userID, postID int64) error
+	}
+	Bookmarks interface {
+		Bookmark(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Unbookmark(ctx context.Context, userID, postID int64) error
+		GetForUser(ctx context.Context, userID int64, collectionID *int64, query PaginatedFeedQuery) ([]Bookmark, Cursors, error)
+		CreateCollection(ctx context.Context, collection *BookmarkCollection) error
+		GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error)
+		DeleteCollection(ctx context.Context, userID, collectionID int64) error
+	}
+	Pins interface {
+		Pin(ctx context.Context, userID, postID int64, limit int) error
+		Unpin(ctx context.Context, userID, postID int64) error
+		GetPinned(ctx context.Context, userID, viewerID int64) ([]Post, error)
+	}
+	Polls interface {
+		Vote(ctx context.Context, postID, userID int64, optionIDs []int64) (*Poll, error)
+	}
+	LinkPreviews interface {
+		GetByURL(ctx context.Context, url string) (*LinkPreview, error)
+		Save(ctx context.Context, preview *LinkPreview) error
+		SetForPost(ctx context.Context, postID int64, previewID *int64) error
+		GetPending(ctx context.Context) ([]int64, error)
+	}
+	Reports interface {
+		Create(ctx context.Context, report *Report) error
+		GetAll(ctx context.Context, query ReportQuery) ([]Report, error)
+		Resolve(ctx context.Context, reportID, moderatorID int64, action, note string) (*ModerationAction, error)
+	}
+	ContentFilters interface {
+		GetRules(ctx context.Context) ([]FilterRule, error)
+		CountRecent(ctx context.Context, userID int64, kind string, since time.Time) (int, error)
+		HasDuplicate(ctx context.Context, userID int64, kind, content string, since time.Time) (bool, error)
+	}
+	Analytics interface {
+		AddViews(ctx context.Context, views []PostViews) error
+		GetForAuthor(ctx context.Context, userID int64, from, to time.Time) ([]PostAnalytics, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		Mute(ctx context.Context, muterID, mutedID int64) error
+		Unmute(ctx context.Context, muterID, mutedID int64) error
+		IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
+		GetBlocked(ctx context.Context, userID int64, query PaginatedFeedQuery) ([]RelatedUser, Cursors, error)
+		GetMuted(ctx context.Context, userID int64, query PaginatedFeedQuery) ([]RelatedUser, Cursors, error)
+	}
+	Mentions interface {
+		GetForUser(ctx context.Context, userID int64, query PaginatedFeedQuery) ([]UserMention, error)
+	}
+	Timelines interface {
+		GetFeed(ctx context.Context, userID int64, query PaginatedFeedQuery) ([]PostWithMetadata, Cursors, error)
+		FanOut(ctx context.Context, job FanoutJob, celebrityFollowers int) error
+		GetPendingFanouts(ctx context.Context, before time.Time) ([]FanoutJob, error)
+		Trim(ctx context.Context, maxEntries int) (int64, error)
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
+		Posts:          &PostStore{db},
+		Users:          &UserStore{db},
+		Comments:       &CommentStore{db},
+		Followers:      &FollowerStore{db},
+		Media:          &MediaStore{db},
+		Mentions:       &MentionStore{db},
+		Reposts:        &RepostStore{db},
+		Bookmarks:      &BookmarkStore{db},
+		Pins:           &PinStore{db},
+		Polls:          &PollStore{db},
+		LinkPreviews:   &LinkPreviewStore{db},
+		Reports:        &ReportStore{db},
+		ContentFilters: &ContentFilterStore{db},
+		Analytics:      &AnalyticsStore{db},
+		Blocks:         &BlockStore{db},
+		Timelines:      &TimelineStore{db},
 	}
 }
 
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// FanoutJob is a post, or a repost when RepostedBy is set, waiting to be
+// copied into the timelines of the followers of its author.
+type FanoutJob struct {
+	PostID     int64
+	RepostedBy int64
+}
+
+// TimelineStore keeps the materialized home feeds. New posts and reposts are
+// fanned out to followers' timelines in the background, follows and
+// unfollows backfill and trim them through a trigger on followers.
+type TimelineStore struct {
+	db *sql.DB
+}
+
+// FanOut copies the post or repost of job into the timelines of the
+// followers of its author and marks it as fanned out. Posts and reposts of
+// accounts with celebrityFollowers followers or more are marked to be merged
+// in by GetFeed instead, so they stay in feeds when the author's follower
+// count changes later. The timelines that grew are queued for Trim. Fanning
+// out twice is harmless.
+//
+// The fan-out grows with the number of followers, so unlike the other
+// queries it isn't bounded by QueryTimeoutDuration but by the deadline of
+// ctx.
+func (s *TimelineStore) FanOut(ctx context.Context, job FanoutJob, celebrityFollowers int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var mergeOnRead bool
+		if job.RepostedBy == 0 {
+			query := `
+			UPDATE posts p SET fanned_out_at = NOW(), merge_on_read = u.followers_count >= $2
+			FROM users u
+			WHERE p.id = $1 AND u.id = p.user_id
+			RETURNING p.merge_on_read
+			`
+			err := tx.QueryRowContext(ctx, query, job.PostID, celebrityFollowers).Scan(&mergeOnRead)
+			if err != nil || mergeOnRead {
+				return ignoreNoRows(err)
+			}
+
+			query = `
+			WITH added AS (
+				INSERT INTO timelines (user_id, post_id, activity_at)
+				SELECT f.follower_id, p.id, p.created_at
+				FROM posts p
+				JOIN followers f ON f.user_id = p.user_id
+				WHERE p.id = $1
+				ON CONFLICT DO NOTHING
+				RETURNING user_id
+			)
+			INSERT INTO timeline_trims (user_id)
+			SELECT DISTINCT user_id FROM added
+			ON CONFLICT DO NOTHING
+			`
+			_, err = tx.ExecContext(ctx, query, job.PostID)
+			return err
+		}
+
+		query := `
+		UPDATE reposts r SET fanned_out_at = NOW(), merge_on_read = u.followers_count >= $3
+		FROM users u
+		WHERE r.user_id = $1 AND r.post_id = $2 AND u.id = r.user_id
+		RETURNING r.merge_on_read
+		`
+		err := tx.QueryRowContext(ctx, query, job.RepostedBy, job.PostID, celebrityFollowers).Scan(&mergeOnRead)
+		if err != nil || mergeOnRead {
+			return ignoreNoRows(err)
+		}
+
+		query = `
+		WITH added AS (
+			INSERT INTO timelines (user_id, post_id, reposted_by, activity_at)
+			SELECT f.follower_id, r.post_id, r.user_id, r.created_at
+			FROM reposts r
+			JOIN followers f ON f.user_id = r.user_id
+			WHERE r.user_id = $1 AND r.post_id = $2
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		)
+		INSERT INTO timeline_trims (user_id)
+		SELECT DISTINCT user_id FROM added
+		ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, job.RepostedBy, job.PostID)
+		return err
+	})
+}
+
+// ignoreNoRows treats a post or repost that was deleted before its fan-out
+// as done.
+func ignoreNoRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// GetPendingFanouts returns the posts and reposts created before before
+// that were never fanned out, oldest first.
+func (s *TimelineStore) GetPendingFanouts(ctx context.Context, before time.Time) ([]FanoutJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	SELECT id, 0, created_at FROM posts WHERE fanned_out_at IS NULL AND created_at < $1
+	UNION ALL
+	SELECT post_id, user_id, created_at FROM reposts WHERE fanned_out_at IS NULL AND created_at < $1
+	ORDER BY created_at
+	`
+	rows, err := s.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []FanoutJob{}
+	for rows.Next() {
+		var job FanoutJob
+		var createdAt time.Time
+		if err := rows.Scan(&job.PostID, &job.RepostedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// trimBatch is how many timelines a single statement of Trim goes through.
+const trimBatch = 500
+
+// Trim drops everything but the latest maxEntries entries of the timelines
+// that grew since they were last trimmed and returns how many entries were
+// dropped. The timelines are taken in batches so every statement stays
+// small. Feeds end where the timeline does, apart from the own and celebrity
+// posts merged in on read.
+func (s *TimelineStore) Trim(ctx context.Context, maxEntries int) (int64, error) {
+	query := `
+	WITH batch AS (
+		DELETE FROM timeline_trims
+		WHERE user_id IN (
+			SELECT user_id FROM timeline_trims
+			ORDER BY user_id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id
+	),
+	cutoff AS (
+		SELECT b.user_id, c.activity_at, c.post_id
+		FROM batch b
+		CROSS JOIN LATERAL (
+			SELECT activity_at, post_id
+			FROM timelines
+			WHERE user_id = b.user_id
+			ORDER BY activity_at DESC, post_id DESC
+			OFFSET $1
+			LIMIT 1
+		) c
+	),
+	dropped AS (
+		DELETE FROM timelines t
+		USING cutoff
+		WHERE t.user_id = cutoff.user_id AND (t.activity_at, t.post_id) <= (cutoff.activity_at, cutoff.post_id)
+		RETURNING 1
+	)
+	SELECT (SELECT COUNT(*) FROM batch), (SELECT COUNT(*) FROM dropped)
+	`
+
+	var total int64
+	for {
+		var trimmed, dropped int64
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			defer cancel()
+			return s.db.QueryRowContext(ctx, query, maxEntries, trimBatch).Scan(&trimmed, &dropped)
+		}()
+		if err != nil {
+			return total, err
+		}
+		total += dropped
+		if trimmed < trimBatch {
+			return total, nil
+		}
+	}
+}
+
+// GetFeed pages through the home feed of userID. It reads the user's
+// materialized timeline and merges in the user's own posts and the posts
+// and reposts of followed accounts that FanOut marked to be merged on read. Visibility, blocks and mutes are applied on read since
+// they can change after a post was fanned out. A cursor takes precedence
+// over the offset, which is only kept for older clients.
+//
+// Each source is read from the cursor on and cut off at the page size
+// before the sources are merged, so a page costs the same however long the
+// timeline is.
+func (s *TimelineStore) GetFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Cursors, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k, err := newKeyset(fq)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	afterTime, afterID := k.Args()
+	offset := fq.Offset
+	if k.After != nil {
+		offset = 0
+	}
+	order := func(activity, id string) string {
+		return activity + ` ` + k.Order + `, ` + id + ` ` + k.Order
+	}
+	// a post shows up once, at its latest activity: when it was written or
+	// when someone the user follows last reposted it
+	query := `
+		WITH entries AS (
+			(
+				SELECT t.post_id, t.activity_at, t.reposted_by
+				FROM timelines t
+				JOIN posts p ON p.id = t.post_id
+				WHERE t.user_id = $1 AND ` + feedEntry("t.activity_at", "t.reposted_by", k.Compare) + `
+				ORDER BY ` + order("t.activity_at", "t.post_id") + `
+				LIMIT $10
+			)
+			UNION ALL
+			(
+				SELECT p.id, p.created_at, NULL::bigint
+				FROM posts p
+				WHERE p.user_id = $1 AND ` + feedEntry("p.created_at", "NULL", k.Compare) + `
+				ORDER BY ` + order("p.created_at", "p.id") + `
+				LIMIT $10
+			)
+			UNION ALL
+			(
+				SELECT cp.id, cp.created_at, NULL
+				FROM followers f
+				CROSS JOIN LATERAL (
+					SELECT p.id, p.created_at
+					FROM posts p
+					WHERE p.user_id = f.user_id AND p.merge_on_read AND ` + feedEntry("p.created_at", "NULL", k.Compare) + `
+					ORDER BY ` + order("p.created_at", "p.id") + `
+					LIMIT $10
+				) cp
+				WHERE f.follower_id = $1
+				ORDER BY ` + order("cp.created_at", "cp.id") + `
+				LIMIT $10
+			)
+			UNION ALL
+			(
+				SELECT cr.post_id, cr.created_at, cr.user_id
+				FROM followers f
+				CROSS JOIN LATERAL (
+					SELECT r.post_id, r.created_at, r.user_id
+					FROM reposts r
+					JOIN posts p ON p.id = r.post_id
+					WHERE r.user_id = f.user_id AND r.merge_on_read AND ` + feedEntry("r.created_at", "r.user_id", k.Compare) + `
+					ORDER BY ` + order("r.created_at", "r.post_id") + `
+					LIMIT $10
+				) cr
+				WHERE f.follower_id = $1
+				ORDER BY ` + order("cr.created_at", "cr.post_id") + `
+				LIMIT $10
+			)
+		),
+		latest AS (
+			SELECT DISTINCT ON (post_id) post_id, activity_at, reposted_by
+			FROM entries
+			ORDER BY post_id, activity_at DESC, reposted_by NULLS FIRST
+		)
+		SELECT 
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags,
+			p.quote_of_id, p.is_quote, p.visibility, u.id, u.username, ru.id, ru.username, l.activity_at,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count,
+			(SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count,
+			(SELECT COUNT(*) FROM posts q WHERE q.quote_of_id = p.id) AS quotes_count
+		FROM latest l
+		JOIN posts p ON p.id = l.post_id
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN users ru ON ru.id = l.reposted_by
+		ORDER BY ` + order("l.activity_at", "p.id") + `
+		LIMIT $2 OFFSET $3
+	`
+	// fetch one extra row to know whether there is a next page
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		fq.Limit+1,
+		offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+		afterTime,
+		afterID,
+		// every source has to cover the skipped rows too
+		fq.Limit+1+offset,
+	)
+	if err != nil {
+		return nil, Cursors{}, err
+	}
+	defer rows.Close()
+	// an empty feed is an empty list, not null
+	feed := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		var reposterID sql.NullInt64
+		var reposterUsername sql.NullString
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.ContentHTML,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.QuoteOfID,
+			&p.IsQuote,
+			&p.Visibility,
+			&p.User.ID,
+			&p.User.Username,
+			&reposterID,
+			&reposterUsername,
+			&p.ActivityAt,
+			&p.CommentCount,
+			&p.RepostCount,
+			&p.QuoteCount,
+		)
+		if err != nil {
+			return nil, Cursors{}, err
+		}
+		if reposterID.Valid {
+			p.RepostedBy = &User{ID: reposterID.Int64, Username: reposterUsername.String}
+		}
+		feed = append(feed, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Cursors{}, err
+	}
+	feed, cursors := pageCursors(feed, fq.Limit, k, k.After != nil || offset > 0, func(p PostWithMetadata) cursor {
+		return cursor{CreatedAt: p.ActivityAt, ID: p.ID}
+	})
+
+	ptrs := make([]*Post, len(feed))
+	for i := range feed {
+		ptrs[i] = &feed[i].Post
+	}
+	if err := loadPostRelations(ctx, s.db, ptrs, &userID); err != nil {
+		return nil, Cursors{}, err
+	}
+	return feed, cursors, nil
+}
+
+// feedEntry returns the conditions for the post p to enter the feed of $1
+// at activity, reposted by reposter or on its own when reposter is NULL.
+// Every source of GetFeed applies them before its limit so pages aren't cut
+// short by entries that are filtered out later. An entry is also left out
+// when the post has a newer repost in the feed, it shows up there instead.
+func feedEntry(activity, reposter, compare string) string {
+	return `NOT EXISTS (SELECT 1 FROM users au WHERE au.id = p.user_id AND au.suspended_at IS NOT NULL)
+		AND NOT ` + mutedBy("$1", "p.user_id") + `
+		AND (` + reposter + ` IS NULL OR (
+			NOT EXISTS (SELECT 1 FROM users au WHERE au.id = ` + reposter + ` AND au.suspended_at IS NOT NULL)
+			AND NOT ` + mutedBy("$1", reposter) + `
+		))
+		AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+		AND (p.tags @> $5 OR $5 = '{}')
+		AND ($6 = '' OR ` + activity + ` >= NULLIF($6, '')::timestamptz)
+		AND ($7 = '' OR ` + activity + ` <= NULLIF($7, '')::timestamptz)
+		AND ($8::timestamptz IS NULL OR (` + activity + `, p.id) ` + compare + ` ($8, $9))
+		AND ` + postVisibleTo("p", "$1") + `
+		AND NOT EXISTS (
+			SELECT 1 FROM timelines nt
+			JOIN users nu ON nu.id = nt.reposted_by
+			WHERE nt.user_id = $1 AND nt.post_id = p.id AND nt.reposted_by IS NOT NULL
+			AND nt.activity_at > ` + activity + `
+			AND nu.suspended_at IS NULL AND NOT ` + mutedBy("$1", "nu.id") + `
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM reposts nr
+			JOIN followers nf ON nf.user_id = nr.user_id AND nf.follower_id = $1
+			JOIN users nu ON nu.id = nr.user_id
+			WHERE nr.post_id = p.id AND nr.created_at > ` + activity + ` AND nr.merge_on_read
+			AND nu.suspended_at IS NULL AND NOT ` + mutedBy("$1", "nu.id") + `
+		)`
+}
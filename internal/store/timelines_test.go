@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+type timelineEntry struct {
+	PostID     int64
+	RepostedBy int64
+}
+
+// timelineEntries returns the materialized timeline of userID, newest first.
+func timelineEntries(t *testing.T, db *sql.DB, userID int64) []timelineEntry {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT post_id, COALESCE(reposted_by, 0) FROM timelines
+		WHERE user_id = $1 ORDER BY activity_at DESC, post_id DESC, reposted_by
+	`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	entries := []timelineEntry{}
+	for rows.Next() {
+		var e timelineEntry
+		if err := rows.Scan(&e.PostID, &e.RepostedBy); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func assertTimeline(t *testing.T, db *sql.DB, userID int64, want ...timelineEntry) {
+	t.Helper()
+	if want == nil {
+		want = []timelineEntry{}
+	}
+	if got := timelineEntries(t, db, userID); !slices.Equal(got, want) {
+		t.Errorf("timeline of user %d is %v, want %v", userID, got, want)
+	}
+}
+
+// backdate moves a post and its timeline entries age into the past so
+// tests don't depend on posts made in the same second.
+func backdate(t *testing.T, db *sql.DB, postID int64, age time.Duration) {
+	t.Helper()
+	at := time.Now().Add(-age)
+	if _, err := db.Exec(`UPDATE posts SET created_at = $2 WHERE id = $1`, postID, at); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE timelines SET activity_at = $2 WHERE post_id = $1 AND reposted_by IS NULL`, postID, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func repost(t *testing.T, s Storage, userID, postID int64) {
+	t.Helper()
+	if err := s.Reposts.Repost(context.Background(), userID, postID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fanOut(t *testing.T, s Storage, job FanoutJob, celebrityFollowers int) {
+	t.Helper()
+	if err := s.Timelines.FanOut(context.Background(), job, celebrityFollowers); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFanOutPost(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, bob.ID, alice.ID)
+
+	post := createTestPost(t, s, alice.ID, "hello")
+	pending, err := s.Timelines.GetPendingFanouts(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(pending, FanoutJob{PostID: post.ID}) {
+		t.Errorf("new post isn't pending, got %v", pending)
+	}
+
+	fanOut(t, s, FanoutJob{PostID: post.ID}, testCelebrityFollowers)
+	// fanning out twice is harmless
+	fanOut(t, s, FanoutJob{PostID: post.ID}, testCelebrityFollowers)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: post.ID})
+	assertTimeline(t, db, alice.ID)
+	assertTimeline(t, db, carol.ID)
+
+	pending, err = s.Timelines.GetPendingFanouts(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(pending, FanoutJob{PostID: post.ID}) {
+		t.Error("post is still pending after its fan-out")
+	}
+}
+
+func TestFanOutRepost(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, bob.ID, carol.ID)
+
+	post := createTestPost(t, s, alice.ID, "hello")
+	backdate(t, db, post.ID, time.Hour)
+	repost(t, s, carol.ID, post.ID)
+	fanOut(t, s, FanoutJob{PostID: post.ID, RepostedBy: carol.ID}, testCelebrityFollowers)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: post.ID, RepostedBy: carol.ID})
+
+	feed, _, err := s.Timelines.GetFeed(context.Background(), bob.ID, feedQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 1 || feed[0].RepostedBy == nil || feed[0].RepostedBy.ID != carol.ID {
+		t.Errorf("got feed %+v, want the post reposted by carol", feed)
+	}
+}
+
+func TestFeedShowsPostAtItsLatestRepost(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, bob.ID, alice.ID)
+	follow(t, s, bob.ID, carol.ID)
+
+	old := createTestPost(t, s, alice.ID, "old")
+	fanOut(t, s, FanoutJob{PostID: old.ID}, testCelebrityFollowers)
+	backdate(t, db, old.ID, 2*time.Hour)
+	newer := createTestPost(t, s, alice.ID, "newer")
+	fanOut(t, s, FanoutJob{PostID: newer.ID}, testCelebrityFollowers)
+	backdate(t, db, newer.ID, time.Hour)
+
+	repost(t, s, carol.ID, old.ID)
+	fanOut(t, s, FanoutJob{PostID: old.ID, RepostedBy: carol.ID}, testCelebrityFollowers)
+	assertFeed(t, s, bob.ID, old.ID, newer.ID)
+
+	// the post must not come back at its original time on the next page
+	fq := feedQuery()
+	fq.Limit = 1
+	var got []int64
+	for page := 0; page < 3; page++ {
+		feed, cursors, err := s.Timelines.GetFeed(context.Background(), bob.ID, fq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range feed {
+			got = append(got, p.ID)
+		}
+		if cursors.Next == "" {
+			break
+		}
+		fq.Cursor = cursors.Next
+	}
+	if want := []int64{old.ID, newer.ID}; !slices.Equal(got, want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
+
+func TestFanOutSkipsCelebrities(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, bob.ID, alice.ID)
+
+	post := createTestPost(t, s, alice.ID, "hello")
+	fanOut(t, s, FanoutJob{PostID: post.ID}, 2)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: post.ID})
+
+	// with a second follower alice counts as a celebrity, her new posts are
+	// merged in on read
+	follow(t, s, carol.ID, alice.ID)
+	later := createTestPost(t, s, alice.ID, "later")
+	fanOut(t, s, FanoutJob{PostID: later.ID}, 2)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: post.ID})
+
+	assertFeed(t, s, bob.ID, later.ID, post.ID)
+
+	// dropping below the threshold again doesn't lose what was merged in
+	unfollow(t, s, carol.ID, alice.ID)
+	last := createTestPost(t, s, alice.ID, "last")
+	fanOut(t, s, FanoutJob{PostID: last.ID}, 2)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: last.ID}, timelineEntry{PostID: post.ID})
+	assertFeed(t, s, bob.ID, last.ID, later.ID, post.ID)
+}
+
+func TestFollowBackfillsTimeline(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+
+	post := createTestPost(t, s, alice.ID, "hello")
+	backdate(t, db, post.ID, time.Hour)
+	repost(t, s, carol.ID, post.ID)
+
+	follow(t, s, bob.ID, alice.ID)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: post.ID})
+
+	follow(t, s, bob.ID, carol.ID)
+	assertTimeline(t, db, bob.ID,
+		timelineEntry{PostID: post.ID, RepostedBy: carol.ID},
+		timelineEntry{PostID: post.ID},
+	)
+}
+
+func TestUnfollowTrimsTimeline(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	dave := createTestUser(t, db, s, "dave")
+
+	alices := createTestPost(t, s, alice.ID, "alice")
+	backdate(t, db, alices.ID, 2*time.Hour)
+	daves := createTestPost(t, s, dave.ID, "dave")
+	backdate(t, db, daves.ID, time.Hour)
+	repost(t, s, carol.ID, alices.ID)
+
+	follow(t, s, bob.ID, alice.ID)
+	follow(t, s, bob.ID, carol.ID)
+	follow(t, s, bob.ID, dave.ID)
+
+	// carol's repost goes, alice's own post stays
+	unfollow(t, s, bob.ID, carol.ID)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: daves.ID}, timelineEntry{PostID: alices.ID})
+
+	unfollow(t, s, bob.ID, alice.ID)
+	assertTimeline(t, db, bob.ID, timelineEntry{PostID: daves.ID})
+}
+
+func TestTrimTimelines(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, s, "alice")
+	bob := createTestUser(t, db, s, "bob")
+	carol := createTestUser(t, db, s, "carol")
+	follow(t, s, bob.ID, alice.ID)
+	follow(t, s, carol.ID, alice.ID)
+
+	var posts []int64
+	for i := range 4 {
+		post := createTestPost(t, s, alice.ID, "post")
+		fanOut(t, s, FanoutJob{PostID: post.ID}, testCelebrityFollowers)
+		backdate(t, db, post.ID, time.Duration(4-i)*time.Hour)
+		posts = append(posts, post.ID)
+	}
+
+	dropped, err := s.Timelines.Trim(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 4 {
+		t.Errorf("dropped %d entries, want 4", dropped)
+	}
+	for _, userID := range []int64{bob.ID, carol.ID} {
+		assertTimeline(t, db, userID, timelineEntry{PostID: posts[3]}, timelineEntry{PostID: posts[2]})
+	}
+
+	// only timelines that grew since are trimmed again
+	if dropped, err := s.Timelines.Trim(context.Background(), 2); err != nil || dropped != 0 {
+		t.Errorf("second trim dropped %d entries, err %v, want none", dropped, err)
+	}
+}
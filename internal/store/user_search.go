@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UserSearchQuery struct {
+	Query  string `json:"q" validate:"required,max=50"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (q UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error) {
+	qs := r.URL.Query()
+	q.Query = strings.TrimSpace(qs.Get("q"))
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+		q.Offset = o
+	}
+	return q, nil
+}
+
+// SuggestedUser is someone to follow, MutualCount is the number of people
+// the viewer follows who already follow them.
+type SuggestedUser struct {
+	User        User `json:"user"`
+	MutualCount int  `json:"mutual_count"`
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search finds active users by username or display name. Prefix matches
+// rank first, then trigram similarity catches typos. Users blocked either
+// way by the viewer are left out.
+func (s *UserStore) Search(ctx context.Context, viewerID int64, q UserSearchQuery) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+	SELECT u.id, u.username, u.display_name, u.bio, COALESCE(am.url, ''), u.followers_count, u.following_count
+	FROM users u
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE u.is_active AND u.suspended_at IS NULL
+	AND (
+		lower(u.username) LIKE $2 || '%' OR lower(u.display_name) LIKE $2 || '%'
+		OR lower(u.username) % $1 OR lower(u.display_name) % $1
+	)
+	AND NOT ` + blockedBetween("u.id", "$3") + `
+	ORDER BY
+		(lower(u.username) LIKE $2 || '%' OR lower(u.display_name) LIKE $2 || '%') DESC,
+		GREATEST(similarity(lower(u.username), $1), similarity(lower(u.display_name), $1)) DESC,
+		u.followers_count DESC,
+		u.id
+	LIMIT $4 OFFSET $5
+	`
+	term := strings.ToLower(q.Query)
+	rows, err := s.db.QueryContext(ctx, query, term, likeEscaper.Replace(term), viewerID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.Bio, &u.AvatarURL, &u.FollowersCount, &u.FollowingCount)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetSuggestions ranks the users followed by the people userID follows by
+// how many of them do. Users already followed or requested, blocked, muted
+// or inactive are left out.
+func (s *UserStore) GetSuggestions(ctx context.Context, userID int64, limit int) ([]SuggestedUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+	SELECT u.id, u.username, u.display_name, u.bio, COALESCE(am.url, ''), u.followers_count, u.following_count,
+		COUNT(*) AS mutual_count
+	FROM followers mine
+	JOIN followers theirs ON theirs.follower_id = mine.user_id
+	JOIN users u ON u.id = theirs.user_id
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE mine.follower_id = $1 AND u.id <> $1
+	AND u.is_active AND u.suspended_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $1)
+	AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = u.id AND fr.requester_id = $1)
+	AND NOT ` + blockedBetween("u.id", "$1") + `
+	AND NOT ` + mutedBy("$1", "u.id") + `
+	GROUP BY u.id, am.url
+	ORDER BY mutual_count DESC, u.followers_count DESC, u.id
+	LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []SuggestedUser{}
+	for rows.Next() {
+		var su SuggestedUser
+		err := rows.Scan(
+			&su.User.ID,
+			&su.User.Username,
+			&su.User.DisplayName,
+			&su.User.Bio,
+			&su.User.AvatarURL,
+			&su.User.FollowersCount,
+			&su.User.FollowingCount,
+			&su.MutualCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, su)
+	}
+	return suggestions, rows.Err()
+}
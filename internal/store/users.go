@@ -6,14 +6,18 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrDuplicateEmail    = errors.New("a user already exists with this email")
 	ErrDuplicateUserName = errors.New("a user already exists with this username")
+	ErrUsernameCooldown  = errors.New("the username was changed too recently, try again later")
 )
 
 type User struct {
@@ -23,6 +27,60 @@ type User struct {
 	Password  password `json:"-"`
 	CreatedAt string   `json:"created_at"`
 	IsActive  bool     `json:"is_active"`
+	Role      string   `json:"role"`
+	// SuspendedAt is set when a moderator suspended the account
+	SuspendedAt   *string `json:"suspended_at,omitempty"`
+	DisplayName   string  `json:"display_name"`
+	Bio           string  `json:"bio"`
+	AvatarMediaID *int64  `json:"avatar_media_id"`
+	AvatarURL     string  `json:"avatar_url"`
+	Location      string  `json:"location"`
+	Website       string  `json:"website"`
+	// Birthday is a YYYY-MM-DD date, BirthdayVisibility says who may see it
+	Birthday           *string `json:"birthday,omitempty"`
+	BirthdayVisibility string  `json:"birthday_visibility"`
+	FollowersCount     int     `json:"followers_count"`
+	FollowingCount     int     `json:"following_count"`
+	// IsPrivate accounts approve their followers through follow requests
+	IsPrivate bool `json:"is_private"`
+}
+
+const (
+	BirthdayPublic    = "public"
+	BirthdayFollowers = "followers"
+	BirthdayPrivate   = "private"
+)
+
+// userColumns are the columns scanned by scanUser, from users aliased as u
+// joined with the avatar media aliased as am.
+const userColumns = `
+	u.id, u.username, u.email, u.created_at, u.is_active, u.role, u.suspended_at,
+	u.display_name, u.bio, u.avatar_media_id, COALESCE(am.url, ''), u.location, u.website,
+	to_char(u.birthday, 'YYYY-MM-DD'), u.birthday_visibility, u.followers_count, u.following_count,
+	u.is_private`
+
+func scanUser(row interface{ Scan(...any) error }, user *User, extra ...any) error {
+	dest := []any{
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.Role,
+		&user.SuspendedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarMediaID,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.Birthday,
+		&user.BirthdayVisibility,
+		&user.FollowersCount,
+		&user.FollowingCount,
+		&user.IsPrivate,
+	}
+	return row.Scan(append(dest, extra...)...)
 }
 
 type password struct {
@@ -49,12 +107,26 @@ type UserStore struct {
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
+
+	if err := lockUsernames(ctx, tx, user.Username); err != nil {
+		return err
+	}
+	// former usernames stay with the user who gave them up
+	var taken bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM username_history WHERE username = $1)`, user.Username).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateUserName
+	}
+
 	query := `
 		INSERT INTO users (username, password, email)
 		VALUES($1,$2,$3)
 		RETURNING id, created_at
 		`
-	err := tx.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		user.Username,
 		user.Password.hash,
 		user.Email,
@@ -78,18 +150,13 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	query := `
-	SELECT id, username, email, password, created_at
-	FROM users
-	WHERE id = $1
+	SELECT ` + userColumns + `, u.password
+	FROM users u
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE u.id = $1
 	`
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-	)
+	err := scanUser(s.db.QueryRowContext(ctx, query, id), user, &user.Password.hash)
 
 	if err != nil {
 		switch err {
@@ -103,6 +170,135 @@ func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	return user, nil
 }
 
+// GetByUsername finds a user by their current username, ignoring case.
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users u
+	LEFT JOIN media am ON am.id = u.avatar_media_id
+	WHERE u.username = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	if err := scanUser(s.db.QueryRowContext(ctx, query, username), user); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// GetRenamedUsername returns the current username of the user who used to
+// go by username.
+func (s *UserStore) GetRenamedUsername(ctx context.Context, username string) (string, error) {
+	query := `
+	SELECT u.username FROM username_history h JOIN users u ON u.id = h.user_id WHERE h.username = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var current string
+	if err := s.db.QueryRowContext(ctx, query, username).Scan(&current); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+	return current, nil
+}
+
+// ChangeUsername renames the user, at most once per cooldown. The old
+// username is kept in the history so it redirects to the new one. Changing
+// only the case of the username is not a rename and isn't limited.
+func (s *UserStore) ChangeUsername(ctx context.Context, user *User, username string, cooldown time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// reload the user under lock, update writes back every column
+		locked := &User{}
+		var changedAt *time.Time
+		query := `
+		SELECT ` + userColumns + `, u.username_changed_at
+		FROM users u
+		LEFT JOIN media am ON am.id = u.avatar_media_id
+		WHERE u.id = $1
+		FOR UPDATE OF u
+		`
+		if err := scanUser(tx.QueryRowContext(ctx, query, user.ID), locked, &changedAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		current := locked.Username
+
+		if err := lockUsernames(ctx, tx, current, username); err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(current, username) {
+			if changedAt != nil && time.Since(*changedAt) < cooldown {
+				return ErrUsernameCooldown
+			}
+
+			var ownerID int64
+			err := tx.QueryRowContext(ctx, `SELECT user_id FROM username_history WHERE username = $1`, username).Scan(&ownerID)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return err
+			case ownerID != user.ID:
+				return ErrDuplicateUserName
+			default:
+				// taking back a former username
+				if _, err := tx.ExecContext(ctx, `DELETE FROM username_history WHERE username = $1`, username); err != nil {
+					return err
+				}
+			}
+
+			query = `
+			INSERT INTO username_history (username, user_id) VALUES ($1, $2)
+			`
+			if _, err := tx.ExecContext(ctx, query, current, user.ID); err != nil {
+				return err
+			}
+		}
+
+		locked.Username = username
+		if err := s.update(ctx, tx, locked); err != nil {
+			return err
+		}
+		user.Username = username
+		return nil
+	})
+}
+
+// lockUsernames serializes the transactions that claim a username or move
+// it to the history, so a name can't be registered while its owner is
+// giving it up. The locks are taken in a fixed order to avoid deadlocks and
+// are released when the transaction ends.
+func lockUsernames(ctx context.Context, tx *sql.Tx, usernames ...string) error {
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = strings.ToLower(username)
+	}
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
@@ -137,9 +333,10 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
 	query := `
-	SELECT u.id, u.username, u.email, u.created_at, u.is_active
+	SELECT ` + userColumns + `
 	FROM users u
 	JOIN user_invitations ui ON u.id = ui.user_id
+	LEFT JOIN media am ON am.id = u.avatar_media_id
 	WHERE ui.token = $1 AND ui.expiry > $2
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -148,13 +345,7 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 	user := &User{}
 	hash := sha256.Sum256([]byte(token))
 	hashToken := hex.EncodeToString(hash[:])
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.CreatedAt,
-		&user.IsActive,
-	)
+	err := scanUser(tx.QueryRowContext(ctx, query, hashToken, time.Now()), user)
 
 	if err != nil {
 		switch err {
@@ -168,18 +359,117 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 	return user, nil
 }
 
+// UpdateProfile saves the editable fields of the user's profile. The avatar
+// has to be an image the user uploaded. Pending follow requests are accepted
+// when the account is public. The other columns are kept as they are in the
+// database, and user is refreshed with them.
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// reload the user under lock so a concurrent rename or activation
+		// isn't undone by update writing back a stale copy
+		locked := &User{}
+		query := `
+		SELECT ` + userColumns + `
+		FROM users u
+		LEFT JOIN media am ON am.id = u.avatar_media_id
+		WHERE u.id = $1
+		FOR UPDATE OF u
+		`
+		if err := scanUser(tx.QueryRowContext(ctx, query, user.ID), locked); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		locked.DisplayName = user.DisplayName
+		locked.Bio = user.Bio
+		locked.AvatarMediaID = user.AvatarMediaID
+		locked.Location = user.Location
+		locked.Website = user.Website
+		locked.Birthday = user.Birthday
+		locked.BirthdayVisibility = user.BirthdayVisibility
+		locked.IsPrivate = user.IsPrivate
+
+		if locked.AvatarMediaID != nil {
+			query = `SELECT url, status FROM media WHERE id = $1 AND user_id = $2 AND mime_type LIKE 'image/%'`
+			var status string
+			err := tx.QueryRowContext(ctx, query, *locked.AvatarMediaID, locked.ID).Scan(&locked.AvatarURL, &status)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return ErrInvalidMedia
+				}
+				return err
+			}
+			if status != MediaStatusReady {
+				return ErrMediaNotReady
+			}
+		} else {
+			locked.AvatarURL = ""
+		}
+		if err := s.update(ctx, tx, locked); err != nil {
+			return err
+		}
+		*user = *locked
+		if user.IsPrivate {
+			return nil
+		}
+		// a public account has nothing left to approve
+		query = `
+		WITH accepted AS (
+			DELETE FROM follow_requests WHERE user_id = $1 RETURNING user_id, requester_id
+		)
+		INSERT INTO followers (user_id, follower_id)
+		SELECT user_id, requester_id FROM accepted
+		ON CONFLICT DO NOTHING
+		`
+		_, err := tx.ExecContext(ctx, query, user.ID)
+		return err
+	})
+}
+
+// update is the single write path for users, every column a user can change
+// is saved here. A rename, ignoring case, also stamps username_changed_at.
 func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
-	query := `UPDATE users SET username = $1, email = $2, is_active = $3 WHERE id = $4`
+	query := `
+	UPDATE users SET
+		username_changed_at = CASE WHEN username <> $1 THEN NOW() ELSE username_changed_at END,
+		username = $1, email = $2, is_active = $3, display_name = $4, bio = $5, avatar_media_id = $6,
+		location = $7, website = $8, birthday = $9, birthday_visibility = $10, is_private = $11
+	WHERE id = $12
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
-
+	res, err := tx.ExecContext(
+		ctx,
+		query,
+		user.Username,
+		user.Email,
+		user.IsActive,
+		user.DisplayName,
+		user.Bio,
+		user.AvatarMediaID,
+		user.Location,
+		user.Website,
+		user.Birthday,
+		user.BirthdayVisibility,
+		user.IsPrivate,
+		user.ID,
+	)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "users_username_key" {
+			return ErrDuplicateUserName
+		}
 		return err
 	}
-
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
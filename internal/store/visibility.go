@@ -0,0 +1,34 @@
+package store
+
+import "fmt"
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+	VisibilityPrivate   = "private"
+)
+
+// postVisibleTo returns a SQL condition that holds when the post aliased as
+// post can be seen by the user id bound to viewer, e.g.
+// postVisibleTo("p", "$1"). Authors always see their own posts, followers
+// see followers-only posts and mentioned users see mentioned-only posts.
+// Public posts of private accounts are treated as followers-only, and
+// nothing is visible between users when either blocked the other.
+// Posts hidden by a moderator are only left visible to their author.
+func postVisibleTo(post, viewer string) string {
+	return fmt.Sprintf(`(
+		%[1]s.user_id = %[2]s
+		OR (%[1]s.hidden_at IS NULL AND NOT %[3]s AND (
+			(%[1]s.visibility = 'public' AND NOT EXISTS (
+				SELECT 1 FROM users vu WHERE vu.id = %[1]s.user_id AND vu.is_private
+			))
+			OR (%[1]s.visibility IN ('public', 'followers') AND EXISTS (
+				SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s.user_id AND vf.follower_id = %[2]s
+			))
+			OR (%[1]s.visibility = 'mentioned' AND EXISTS (
+				SELECT 1 FROM mentions vm WHERE vm.post_id = %[1]s.id AND vm.comment_id IS NULL AND vm.mentioned_user_id = %[2]s
+			))
+		))
+	)`, post, viewer, blockedBetween(post+".user_id", viewer))
+}
@@ -0,0 +1,137 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+var ErrQueueFull = errors.New("timeline fan-out queue is full")
+
+type Config struct {
+	Workers   int
+	QueueSize int
+	// Timeout bounds a single fan-out, which takes longer the more followers
+	// the author has
+	Timeout time.Duration
+	// CelebrityFollowers is the follower count from which an account's posts
+	// are merged into feeds when they are read instead of fanned out
+	CelebrityFollowers int
+	// SweepInterval is how often posts and reposts that missed the queue are
+	// requeued and the timelines are trimmed
+	SweepInterval time.Duration
+	// MaxEntries is how many entries a timeline keeps, 0 keeps them all
+	MaxEntries int
+}
+
+// Fanout copies new posts and reposts into the timelines of the author's
+// followers in the background. Posts fanned out late show up in feeds at
+// their original time, so a full queue or a restart only delays them until
+// the next sweep.
+type Fanout struct {
+	store  store.Storage
+	logger *zap.SugaredLogger
+	config Config
+	jobs   chan store.FanoutJob
+}
+
+func NewFanout(storage store.Storage, logger *zap.SugaredLogger, config Config) *Fanout {
+	return &Fanout{
+		store:  storage,
+		logger: logger,
+		config: config,
+		jobs:   make(chan store.FanoutJob, config.QueueSize),
+	}
+}
+
+// Start launches the workers and the sweeper. They stop when ctx is
+// cancelled.
+func (f *Fanout) Start(ctx context.Context) {
+	for i := 0; i < f.config.Workers; i++ {
+		go f.work(ctx)
+	}
+	go f.sweepEvery(ctx)
+}
+
+func (f *Fanout) sweepEvery(ctx context.Context) {
+	// everything pending at startup was left over by a previous run
+	f.sweep(ctx, time.Now())
+
+	ticker := time.NewTicker(f.config.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// younger posts may still be waiting in the queue
+			f.sweep(ctx, time.Now().Add(-f.config.SweepInterval))
+		}
+	}
+}
+
+// sweep requeues the posts and reposts created before before that are still
+// waiting for their fan-out, then trims the timelines to MaxEntries.
+func (f *Fanout) sweep(ctx context.Context, before time.Time) {
+	jobs, err := f.store.Timelines.GetPendingFanouts(ctx, before)
+	if err != nil {
+		f.logger.Errorw("failed to load pending fan-outs", "error", err.Error())
+	}
+	for _, job := range jobs {
+		select {
+		case f.jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if f.config.MaxEntries <= 0 {
+		return
+	}
+	dropped, err := f.store.Timelines.Trim(ctx, f.config.MaxEntries)
+	if err != nil {
+		f.logger.Errorw("failed to trim timelines", "error", err.Error())
+		return
+	}
+	if dropped > 0 {
+		f.logger.Infow("trimmed timelines", "entries", dropped)
+	}
+}
+
+// EnqueuePost schedules a new post for fan-out without blocking the caller.
+func (f *Fanout) EnqueuePost(postID int64) error {
+	return f.enqueue(store.FanoutJob{PostID: postID})
+}
+
+// EnqueueRepost schedules userID's repost of a post for fan-out without
+// blocking the caller.
+func (f *Fanout) EnqueueRepost(userID, postID int64) error {
+	return f.enqueue(store.FanoutJob{PostID: postID, RepostedBy: userID})
+}
+
+func (f *Fanout) enqueue(job store.FanoutJob) error {
+	select {
+	case f.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (f *Fanout) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-f.jobs:
+			jobCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+			if err := f.store.Timelines.FanOut(jobCtx, job, f.config.CelebrityFollowers); err != nil {
+				f.logger.Errorw("timeline fan-out failed", "post_id", job.PostID, "reposted_by", job.RepostedBy, "error", err.Error())
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeTimelines keeps the pending fan-outs in memory.
+type fakeTimelines struct {
+	mu      sync.Mutex
+	pending map[store.FanoutJob]bool
+	trims   int
+}
+
+func (f *fakeTimelines) GetFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, store.Cursors, error) {
+	return nil, store.Cursors{}, nil
+}
+
+func (f *fakeTimelines) FanOut(ctx context.Context, job store.FanoutJob, celebrityFollowers int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pending, job)
+	return nil
+}
+
+func (f *fakeTimelines) GetPendingFanouts(ctx context.Context, before time.Time) ([]store.FanoutJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	jobs := []store.FanoutJob{}
+	for job := range f.pending {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (f *fakeTimelines) Trim(ctx context.Context, maxEntries int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trims++
+	return 0, nil
+}
+
+func (f *fakeTimelines) add(job store.FanoutJob) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending[job] = true
+}
+
+func (f *fakeTimelines) done() (pending, trims int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pending), f.trims
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFanoutSweepsJobsThatMissedTheQueue(t *testing.T) {
+	timelines := &fakeTimelines{pending: map[store.FanoutJob]bool{
+		// left over by a previous run
+		{PostID: 1}: true,
+	}}
+	f := NewFanout(store.Storage{Timelines: timelines}, zap.NewNop().Sugar(), Config{
+		Workers:       1,
+		QueueSize:     1,
+		Timeout:       time.Second,
+		SweepInterval: 20 * time.Millisecond,
+		MaxEntries:    10,
+	})
+
+	// fill the queue before the workers run so the next enqueue fails
+	missed := store.FanoutJob{PostID: 3, RepostedBy: 2}
+	timelines.add(store.FanoutJob{PostID: 2})
+	if err := f.EnqueuePost(2); err != nil {
+		t.Fatal(err)
+	}
+	timelines.add(missed)
+	if err := f.EnqueueRepost(missed.RepostedBy, missed.PostID); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.Start(ctx)
+
+	waitFor(t, "the pending fan-outs", func() bool {
+		pending, _ := timelines.done()
+		return pending == 0
+	})
+	waitFor(t, "a second sweep", func() bool {
+		_, trims := timelines.done()
+		return trims >= 2
+	})
+}
+
+func TestFanoutKeepsTimelinesWithoutMaxEntries(t *testing.T) {
+	timelines := &fakeTimelines{pending: map[store.FanoutJob]bool{}}
+	f := NewFanout(store.Storage{Timelines: timelines}, zap.NewNop().Sugar(), Config{
+		Workers:       1,
+		QueueSize:     1,
+		Timeout:       time.Second,
+		SweepInterval: time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	f.Start(ctx)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if _, trims := timelines.done(); trims != 0 {
+		t.Errorf("timelines were trimmed %d times without MaxEntries", trims)
+	}
+}
@@ -0,0 +1,100 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/temideewan/go-social/internal/store"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+)
+
+// parse reads the OpenGraph and Twitter card meta tags from the head of an
+// html document, falling back to the <title> and description meta tags.
+// base is the url the document was served from.
+func parse(r io.Reader, base *url.URL) *store.LinkPreview {
+	meta := map[string]string{}
+	var title string
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				if title == "" && z.Next() == html.TextToken {
+					title = string(z.Text())
+				}
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				var key, content string
+				for {
+					k, v, more := z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(string(v)))
+					case "content":
+						content = string(v)
+					}
+					if !more {
+						break
+					}
+				}
+				// the first occurrence wins, later ones are usually extra images
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = content
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				break loop
+			}
+		}
+	}
+
+	preview := &store.LinkPreview{
+		URL:         base.String(),
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title), maxTitleLength),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLength),
+		SiteName:    clean(first(meta["og:site_name"], base.Hostname()), maxSiteNameLength),
+	}
+
+	image := first(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])
+	if u, err := base.Parse(strings.TrimSpace(image)); image != "" && err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		preview.ImageURL = u.String()
+	}
+	return preview
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and cuts s to at most max characters.
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
@@ -0,0 +1,103 @@
+package unfurl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/gophers")
+
+	tests := []struct {
+		name        string
+		html        string
+		title       string
+		description string
+		image       string
+		siteName    string
+	}{
+		{
+			name: "open graph",
+			html: `<head>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content="OG description">
+				<meta property="og:image" content="https://cdn.example.com/a.png">
+				<meta property="og:site_name" content="Example">
+				<title>Page title</title>
+			</head>`,
+			title:       "OG title",
+			description: "OG description",
+			image:       "https://cdn.example.com/a.png",
+			siteName:    "Example",
+		},
+		{
+			name: "twitter card",
+			html: `<head>
+				<meta name="twitter:title" content="Twitter title">
+				<meta name="twitter:description" content="Twitter description">
+				<meta name="twitter:image" content="/b.png">
+			</head>`,
+			title:       "Twitter title",
+			description: "Twitter description",
+			image:       "https://example.com/b.png",
+			siteName:    "example.com",
+		},
+		{
+			name:        "plain html fallbacks",
+			html:        `<head><title> Page   title </title><meta name="description" content="Meta description"></head>`,
+			title:       "Page title",
+			description: "Meta description",
+			siteName:    "example.com",
+		},
+		{
+			name: "first tag wins",
+			html: `<head>
+				<meta property="og:image" content="https://example.com/first.png">
+				<meta property="og:image" content="https://example.com/second.png">
+			</head>`,
+			image:    "https://example.com/first.png",
+			siteName: "example.com",
+		},
+		{
+			name:     "unsafe image scheme",
+			html:     `<head><meta property="og:image" content="javascript:alert(1)"></head>`,
+			siteName: "example.com",
+		},
+		{
+			name:     "tags in the body are ignored",
+			html:     `<head></head><body><meta property="og:title" content="Body title"></body>`,
+			siteName: "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parse(strings.NewReader(tt.html), base)
+			if p.Title != tt.title {
+				t.Errorf("Title = %q, want %q", p.Title, tt.title)
+			}
+			if p.Description != tt.description {
+				t.Errorf("Description = %q, want %q", p.Description, tt.description)
+			}
+			if p.ImageURL != tt.image {
+				t.Errorf("ImageURL = %q, want %q", p.ImageURL, tt.image)
+			}
+			if p.SiteName != tt.siteName {
+				t.Errorf("SiteName = %q, want %q", p.SiteName, tt.siteName)
+			}
+		})
+	}
+}
+
+func TestParseTruncatesLongTitles(t *testing.T) {
+	base, _ := url.Parse("https://example.com")
+	long := strings.Repeat("é", maxTitleLength+10)
+	p := parse(strings.NewReader(`<head><meta property="og:title" content="`+long+`"></head>`), base)
+	if n := len([]rune(p.Title)); n != maxTitleLength {
+		t.Errorf("title has %d characters, want %d", n, maxTitleLength)
+	}
+	if !strings.HasSuffix(p.Title, "…") {
+		t.Errorf("truncated title %q doesn't end with an ellipsis", p.Title)
+	}
+}
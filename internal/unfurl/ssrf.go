@@ -0,0 +1,97 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+const maxRedirects = 3
+
+// blockedPrefixes are ranges that netip doesn't already flag as private,
+// loopback, link-local or multicast but still must not be reachable.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+func isBlocked(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressChecker returns the dialer's Control hook. It runs after dns
+// resolution, right before connecting, so a hostname can't resolve to a safe
+// address at check time and an internal one at dial time. Addresses in
+// allowed are let through even when they are blocked.
+func addressChecker(allowed []netip.Prefix) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		ip := addrPort.Addr().Unmap()
+		for _, p := range allowed {
+			if p.Contains(ip) {
+				return nil
+			}
+		}
+		if isBlocked(ip) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+		}
+		return nil
+	}
+}
+
+// newClient returns an http client that refuses to connect to private or
+// internal addresses other than the allowed ones, including through
+// redirects.
+func newClient(timeout time.Duration, allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: addressChecker(allowed),
+	}
+	transport := &http.Transport{
+		// no proxy, it would connect on our behalf and skip the address check
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package unfurl
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestIsBlocked(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.0.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+	}
+	for _, tt := range tests {
+		if got := isBlocked(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+			t.Errorf("isBlocked(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+}
+
+func TestAddressCheckerAllowList(t *testing.T) {
+	check := addressChecker([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	if err := check("tcp4", "127.0.0.1:8080", nil); err != nil {
+		t.Errorf("allowed address was blocked: %v", err)
+	}
+	if err := check("tcp4", "127.0.0.2:8080", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v for an address outside the allow list, want ErrBlockedAddress", err)
+	}
+	if err := check("tcp6", "[::ffff:127.0.0.1]:8080", nil); err != nil {
+		t.Errorf("mapped allowed address was blocked: %v", err)
+	}
+}
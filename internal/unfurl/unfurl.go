@@ -0,0 +1,183 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/temideewan/go-social/internal/entities"
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+var ErrQueueFull = errors.New("link preview queue is full")
+
+type Config struct {
+	Workers     int
+	QueueSize   int
+	Timeout     time.Duration
+	MaxBodySize int64
+	CacheTTL    time.Duration
+	UserAgent   string
+	// AllowedPrefixes are reachable even though they are private or
+	// loopback addresses, tests use it to reach a local server
+	AllowedPrefixes []netip.Prefix
+}
+
+// Unfurler fetches the first url of a post in the background and attaches
+// a preview card built from the page's meta tags.
+type Unfurler struct {
+	store  store.Storage
+	logger *zap.SugaredLogger
+	config Config
+	client *http.Client
+	jobs   chan int64
+}
+
+func NewUnfurler(store store.Storage, logger *zap.SugaredLogger, config Config) *Unfurler {
+	return &Unfurler{
+		store:  store,
+		logger: logger,
+		config: config,
+		client: newClient(config.Timeout, config.AllowedPrefixes),
+		jobs:   make(chan int64, config.QueueSize),
+	}
+}
+
+// HasURL reports whether content would get a link preview.
+func HasURL(content string) bool {
+	return len(entities.URLs(content)) > 0
+}
+
+// Start launches the workers and requeues the posts a previous run didn't
+// get to. Workers stop when ctx is cancelled.
+func (u *Unfurler) Start(ctx context.Context) {
+	for i := 0; i < u.config.Workers; i++ {
+		go u.work(ctx)
+	}
+
+	go func() {
+		ids, err := u.store.LinkPreviews.GetPending(ctx)
+		if err != nil {
+			u.logger.Errorw("failed to load pending link previews", "error", err.Error())
+			return
+		}
+		for _, id := range ids {
+			select {
+			case u.jobs <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Enqueue schedules a post for unfurling without blocking the caller.
+func (u *Unfurler) Enqueue(postID int64) error {
+	select {
+	case u.jobs <- postID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (u *Unfurler) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-u.jobs:
+			jobCtx, cancel := context.WithTimeout(ctx, 2*u.config.Timeout)
+			if err := u.process(jobCtx, id); err != nil {
+				u.logger.Errorw("link preview failed", "post_id", id, "error", err.Error())
+			}
+			cancel()
+		}
+	}
+}
+
+func (u *Unfurler) process(ctx context.Context, postID int64) error {
+	post, err := u.store.Posts.GetById(ctx, postID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			// deleted before we got to it
+			return nil
+		}
+		return err
+	}
+
+	urls := entities.URLs(post.Content)
+	if len(urls) == 0 {
+		return u.store.LinkPreviews.SetForPost(ctx, postID, nil)
+	}
+	target, err := url.Parse(urls[0].Text)
+	if err != nil || target.Hostname() == "" {
+		return u.store.LinkPreviews.SetForPost(ctx, postID, nil)
+	}
+	target.Fragment = ""
+
+	preview, err := u.store.LinkPreviews.GetByURL(ctx, target.String())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if preview == nil || time.Since(preview.FetchedAt) > u.config.CacheTTL {
+		preview, err = u.fetch(ctx, target)
+		if err != nil {
+			u.logger.Infow("could not unfurl url", "post_id", postID, "url", target.String(), "error", err.Error())
+			preview = &store.LinkPreview{Failed: true}
+		}
+		// cache under the url from the post, not the one we were redirected to
+		preview.URL = target.String()
+		if err := u.store.LinkPreviews.Save(ctx, preview); err != nil {
+			return err
+		}
+	}
+
+	if preview.Failed {
+		return u.store.LinkPreviews.SetForPost(ctx, postID, nil)
+	}
+	return u.store.LinkPreviews.SetForPost(ctx, postID, &preview.ID)
+}
+
+func (u *Unfurler) fetch(ctx context.Context, target *url.URL) (*store.LinkPreview, error) {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", u.config.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	if resp.ContentLength > u.config.MaxBodySize {
+		return nil, fmt.Errorf("page is too large: %d bytes", resp.ContentLength)
+	}
+
+	preview := parse(io.LimitReader(resp.Body, u.config.MaxBodySize), resp.Request.URL)
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errors.New("page has no title or description")
+	}
+	return preview, nil
+}
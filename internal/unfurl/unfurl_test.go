@@ -0,0 +1,189 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/temideewan/go-social/internal/store"
+	"go.uber.org/zap"
+)
+
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+
+func newTestUnfurler(allowed []netip.Prefix) *Unfurler {
+	return NewUnfurler(store.Storage{}, zap.NewNop().Sugar(), Config{
+		Workers:         1,
+		QueueSize:       1,
+		Timeout:         time.Second,
+		MaxBodySize:     1 << 10,
+		UserAgent:       "GopherSocialBot/test",
+		AllowedPrefixes: allowed,
+	})
+}
+
+func fetchURL(t *testing.T, u *Unfurler, raw string) (*store.LinkPreview, error) {
+	t.Helper()
+	target, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.fetch(context.Background(), target)
+}
+
+func TestFetchParsesCard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != "GopherSocialBot/test" {
+			t.Errorf("User-Agent = %q", got)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<meta property="og:title" content="Gophers">
+			<meta property="og:description" content="All about gophers">
+			<meta property="og:image" content="/img/gopher.png">
+		</head><body></body></html>`)
+	}))
+	defer srv.Close()
+
+	preview, err := fetchURL(t, newTestUnfurler(loopback), srv.URL+"/post")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if preview.Title != "Gophers" || preview.Description != "All about gophers" {
+		t.Errorf("got title %q and description %q", preview.Title, preview.Description)
+	}
+	if want := srv.URL + "/img/gopher.png"; preview.ImageURL != want {
+		t.Errorf("ImageURL = %q, want %q", preview.ImageURL, want)
+	}
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached the server")
+	}))
+	defer srv.Close()
+
+	_, err := fetchURL(t, newTestUnfurler(nil), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	u := newTestUnfurler(nil)
+	for _, raw := range []string{
+		"http://10.0.0.1/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://[fd00::1]/",
+		"http://0.0.0.0/",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := fetchURL(t, u, raw)
+			if !errors.Is(err, ErrBlockedAddress) {
+				t.Errorf("got %v, want ErrBlockedAddress", err)
+			}
+		})
+	}
+}
+
+func TestFetchBlocksRedirectToPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	_, err := fetchURL(t, newTestUnfurler(loopback), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchStopsAfterTooManyRedirects(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	if _, err := fetchURL(t, newTestUnfurler(loopback), srv.URL+"/"); err == nil {
+		t.Error("fetch followed redirects forever")
+	}
+}
+
+func TestFetchRejectsLargeBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "4096")
+		fmt.Fprint(w, strings.Repeat(" ", 4096))
+	}))
+	defer srv.Close()
+
+	if _, err := fetchURL(t, newTestUnfurler(loopback), srv.URL); err == nil {
+		t.Error("fetch accepted a body over MaxBodySize")
+	}
+}
+
+func TestFetchReadsAtMostMaxBodySize(t *testing.T) {
+	// without a Content-Length the body is cut off at MaxBodySize, so meta
+	// tags past it are never seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><!--"+strings.Repeat("x", 2048)+`-->`)
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, `<meta property="og:title" content="Too late"></head></html>`)
+	}))
+	defer srv.Close()
+
+	if preview, err := fetchURL(t, newTestUnfurler(loopback), srv.URL); err == nil {
+		t.Errorf("fetch read past MaxBodySize and found %q", preview.Title)
+	}
+}
+
+func TestFetchTimesOut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	u := newTestUnfurler(loopback)
+	u.config.Timeout = 100 * time.Millisecond
+	u.client = newClient(u.config.Timeout, loopback)
+
+	start := time.Now()
+	if _, err := fetchURL(t, u, srv.URL); err == nil {
+		t.Fatal("fetch of a hanging server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch gave up after %s", elapsed)
+	}
+}
+
+func TestFetchRejectsNonHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title": "Gophers"}`)
+	}))
+	defer srv.Close()
+
+	if _, err := fetchURL(t, newTestUnfurler(loopback), srv.URL); err == nil {
+		t.Error("fetch accepted a json response")
+	}
+}
+
+func TestFetchRejectsOtherSchemes(t *testing.T) {
+	if _, err := fetchURL(t, newTestUnfurler(nil), "file:///etc/passwd"); err == nil {
+		t.Error("fetch accepted a file url")
+	}
+}